@@ -0,0 +1,132 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleLastHeard serves GET /api/lastheard[?limit=N]
+func (c *Client) handleLastHeard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	writeJSON(w, c.heard.recent(limit))
+}
+
+// apiStatus is the body of GET /status
+type apiStatus struct {
+	Paused        bool    `json:"paused"`
+	ActiveStreams int     `json:"activeStreams"`
+	Uptime        float64 `json:"uptime"` // seconds
+}
+
+// handleStatus serves GET /status
+func (c *Client) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, c.status())
+}
+
+// handlePause returns a handler for POST /pause or /resume, which sets
+// whether received packets are ignored and returns the new status
+func (c *Client) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if c.paused.Swap(paused) != paused {
+			if paused {
+				slog.Info("monitoring paused", "remote", r.RemoteAddr)
+			} else {
+				slog.Info("monitoring resumed", "remote", r.RemoteAddr)
+			}
+		}
+		writeJSON(w, c.status())
+	}
+}
+
+// status returns the current client status
+func (c *Client) status() apiStatus {
+	return apiStatus{
+		Paused:        c.paused.Load(),
+		ActiveStreams: c.streams.count(),
+		Uptime:        time.Since(c.started).Seconds(),
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Debug("failed to write API response", "err", err)
+	}
+}
+
+// apiHandler routes the REST API. The control endpoints are served at the
+// top level and, alongside the last heard list, under /api/.
+func (c *Client) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/lastheard", c.handleLastHeard)
+	for _, prefix := range []string{"", "/api"} {
+		mux.HandleFunc(prefix+"/status", c.handleStatus)
+		mux.HandleFunc(prefix+"/pause", c.handlePause(true))
+		mux.HandleFunc(prefix+"/resume", c.handlePause(false))
+	}
+	return mux
+}
+
+// serveAPI starts an HTTP server with the REST API on addr
+func (c *Client) serveAPI(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	srv := &http.Server{Handler: c.apiHandler()}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("API server failed", "err", err)
+		}
+	}()
+
+	return srv, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-m17gateway-monitor/m17"
+)
+
+func TestAPIPauseResume(t *testing.T) {
+	for _, prefix := range []string{"", "/api"} {
+		t.Run("prefix "+prefix, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{})
+			srv := httptest.NewServer(c.apiHandler())
+			defer srv.Close()
+
+			tests := []struct {
+				method, path string
+				code         int
+				paused       bool
+				played       int // frames played after a frame is received
+			}{
+				{http.MethodGet, "/status", http.StatusOK, false, 1},
+				{http.MethodPost, "/pause", http.StatusOK, true, 1},
+				{http.MethodGet, "/status", http.StatusOK, true, 1},
+				{http.MethodPost, "/pause", http.StatusOK, true, 1},
+				{http.MethodGet, "/resume", http.StatusMethodNotAllowed, true, 1},
+				{http.MethodPost, "/status", http.StatusMethodNotAllowed, true, 1},
+				{http.MethodPost, "/resume", http.StatusOK, false, 2},
+			}
+			for i, tt := range tests {
+				req, err := http.NewRequest(tt.method, srv.URL+prefix+tt.path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var status apiStatus
+				if resp.StatusCode == http.StatusOK {
+					err = json.NewDecoder(resp.Body).Decode(&status)
+				}
+				resp.Body.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != tt.code {
+					t.Errorf("step %d: %s %s = %d, want %d", i, tt.method, tt.path, resp.StatusCode, tt.code)
+				}
+				if resp.StatusCode == http.StatusOK && status.Paused != tt.paused {
+					t.Errorf("step %d: %s %s reports paused %t, want %t", i, tt.method, tt.path, status.Paused, tt.paused)
+				}
+
+				c.handlePacket("", makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, uint16(i), make([]byte, m17.PayloadSize)))
+				if len(*frames) != tt.played {
+					t.Errorf("step %d: played %d frames, want %d", i, len(*frames), tt.played)
+				}
+			}
+		})
+	}
+}
+
+func TestPauseFlushesJitter(t *testing.T) {
+	c, frames := newTestClient(t, Config{Jitter: 2})
+	c.paused.Store(true)
+	for fn := uint16(0); fn < 3; fn++ {
+		c.jitter.add("", 1, fn, false, makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, fn, make([]byte, m17.PayloadSize)))
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.jitter.mu.Lock()
+		buffered := len(c.jitter.streams)
+		c.jitter.mu.Unlock()
+		if buffered == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("jitter buffer not flushed while paused")
+		}
+		time.Sleep(jitterTick)
+	}
+
+	// Stop the release goroutine before looking at what it played
+	c.Close()
+	if len(*frames) != 0 {
+		t.Errorf("played %d buffered frames while paused, want none", len(*frames))
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APRS-IS gateway settings
+const (
+	aprsQueueSize       = 16
+	aprsDialTimeout     = 10 * time.Second
+	aprsWriteTimeout    = 10 * time.Second
+	DefaultAPRSInterval = 600 // seconds between beacons for one station
+)
+
+// aprsGateway forwards stream positions to APRS-IS without blocking the
+// decode path, sending at most one beacon per station per interval
+type aprsGateway struct {
+	server   string
+	call     string
+	pass     string
+	interval time.Duration
+	queue    chan string
+
+	mu   sync.Mutex
+	sent map[string]time.Time // last beacon time by APRS callsign
+}
+
+// newAPRSGateway creates a gateway logging in to server (host:port) as call.
+// The connection is made when the first beacon is sent.
+func newAPRSGateway(server, call, pass string, interval time.Duration) *aprsGateway {
+	return &aprsGateway{
+		server:   server,
+		call:     strings.ToUpper(call),
+		pass:     pass,
+		interval: interval,
+		queue:    make(chan string, aprsQueueSize),
+		sent:     make(map[string]time.Time),
+	}
+}
+
+// report queues a beacon for src at pos unless the station beaconed within
+// the interval
+func (g *aprsGateway) report(src string, pos Position, now time.Time) {
+	call, ok := aprsCallsign(src)
+	if !ok {
+		slog.Debug("callsign not valid for APRS, not beaconing", "src", src)
+		return
+	}
+
+	g.mu.Lock()
+	last, seen := g.sent[call]
+	if seen && now.Sub(last) < g.interval {
+		g.mu.Unlock()
+		return
+	}
+	g.sent[call] = now
+	g.mu.Unlock()
+
+	select {
+	case g.queue <- aprsPacket(call, pos):
+	default:
+		slog.Warn("APRS-IS queue full, dropping beacon", "src", src)
+	}
+}
+
+// aprsCallsign converts an M17 callsign to an APRS source callsign. A space
+// before a suffix becomes an SSID hyphen, e.g. "KC1AWV 7" is "KC1AWV-7".
+// Callsigns with other punctuation, or too long for APRS, have no equivalent.
+func aprsCallsign(src string) (string, bool) {
+	call := strings.Join(strings.Fields(src), "-")
+	if call == "" || len(call) > 9 {
+		return "", false
+	}
+	base, ssid, hasSSID := strings.Cut(call, "-")
+	if base == "" || (hasSSID && (ssid == "" || len(ssid) > 2 || strings.Contains(ssid, "-"))) {
+		return "", false
+	}
+	for _, r := range base + ssid {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return "", false
+		}
+	}
+	return call, true
+}
+
+// aprsPacket formats an uncompressed APRS position report for src, sent over
+// TCPIP. The q-construct is left for the APRS-IS server to add. Course and
+// speed, and altitude, are included when known.
+func aprsPacket(src string, pos Position) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s>APRS,TCPIP*:!%s/%s[", src,
+		aprsCoordinate(pos.Latitude, 2, "N", "S"),
+		aprsCoordinate(pos.Longitude, 3, "E", "W"))
+	if pos.Speed != nil && pos.Bearing != nil {
+		course := int(math.Round(*pos.Bearing)) % 360
+		if course == 0 {
+			course = 360 // 000 means the course is unknown
+		}
+		fmt.Fprintf(&b, "%03d/%03d", course, min(int(math.Round(*pos.Speed/1.852)), 999))
+	}
+	if pos.Altitude != nil {
+		fmt.Fprintf(&b, "/A=%06d", int(math.Round(*pos.Altitude/0.3048)))
+	}
+	b.WriteString(" M17")
+	return b.String()
+}
+
+// aprsCoordinate formats a coordinate as degrees and decimal minutes, with
+// the degrees zero padded to width digits and a hemisphere letter
+func aprsCoordinate(v float64, width int, pos, neg string) string {
+	hemisphere := pos
+	if v < 0 {
+		hemisphere, v = neg, -v
+	}
+	hundredths := int(math.Round(v * 6000)) // hundredths of a minute
+	return fmt.Sprintf("%0*d%02d.%02d%s", width, hundredths/6000, hundredths%6000/100, hundredths%100, hemisphere)
+}
+
+// run sends queued beacons until ctx is cancelled, connecting and logging in
+// on demand and reconnecting after the connection fails
+func (g *aprsGateway) run(ctx context.Context) {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet := <-g.queue:
+			if conn == nil {
+				var err error
+				if conn, err = g.login(ctx); err != nil {
+					slog.Warn("APRS-IS unavailable, dropping beacon", "server", g.server, "err", err)
+					continue
+				}
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(aprsWriteTimeout))
+			if _, err := io.WriteString(conn, packet+"\r\n"); err != nil {
+				slog.Warn("failed to send APRS-IS beacon", "server", g.server, "err", err)
+				conn.Close()
+				conn = nil
+				continue
+			}
+			slog.Debug("sent APRS-IS beacon", "packet", packet)
+		}
+	}
+}
+
+// login connects to the APRS-IS server and sends the login line. Lines from
+// the server are read and discarded so its keepalives don't back up.
+func (g *aprsGateway) login(ctx context.Context) (net.Conn, error) {
+	d := net.Dialer{Timeout: aprsDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", g.server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to APRS-IS: %w", err)
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(aprsWriteTimeout))
+	if _, err := fmt.Fprintf(conn, "user %s pass %s vers go-m17gateway-monitor %s\r\n", g.call, g.pass, version); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to log in to APRS-IS: %w", err)
+	}
+	go io.Copy(io.Discard, conn)
+
+	slog.Info("connected to APRS-IS", "server", g.server, "call", g.call)
+	return conn, nil
+}
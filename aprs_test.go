@@ -0,0 +1,105 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPRSPacket(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name string
+		pos  Position
+		want string
+	}{
+		{"north east", Position{Latitude: 42.5, Longitude: 71.25},
+			"KC1AWV>APRS,TCPIP*:!4230.00N/07115.00E[ M17"},
+		{"south west", Position{Latitude: -33.8568, Longitude: -151.2153},
+			"KC1AWV>APRS,TCPIP*:!3351.41S/15112.92W[ M17"},
+		{"rounds up to the next degree", Position{Latitude: 42.999999, Longitude: -0.0001},
+			"KC1AWV>APRS,TCPIP*:!4300.00N/00000.01W[ M17"},
+		{"altitude", Position{Latitude: -33.8568, Longitude: -151.2153, Altitude: float(101.19)},
+			"KC1AWV>APRS,TCPIP*:!3351.41S/15112.92W[/A=000332 M17"},
+		{"below sea level", Position{Latitude: 31.5, Longitude: 35.5, Altitude: float(-430)},
+			"KC1AWV>APRS,TCPIP*:!3130.00N/03530.00E[/A=-01411 M17"},
+		{"course and speed", Position{Latitude: 42.5, Longitude: -71.25, Speed: float(16.09), Bearing: float(90)},
+			"KC1AWV>APRS,TCPIP*:!4230.00N/07115.00W[090/009 M17"},
+		{"due north", Position{Latitude: 42.5, Longitude: -71.25, Speed: float(100), Bearing: float(0), Altitude: float(101.19)},
+			"KC1AWV>APRS,TCPIP*:!4230.00N/07115.00W[360/054/A=000332 M17"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aprsPacket("KC1AWV", tt.pos); got != tt.want {
+				t.Errorf("aprsPacket = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPRSCallsign(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+		ok   bool
+	}{
+		{"KC1AWV", "KC1AWV", true},
+		{"KC1AWV 7", "KC1AWV-7", true},
+		{"KC1AWV  15", "KC1AWV-15", true},
+		{"KC1AWV 123", "", false},
+		{"KC1AWV/P", "", false},
+		{"M17-XXX", "", false},
+		{"KC1AWVXYZW", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, ok := aprsCallsign(tt.src)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("aprsCallsign(%q) = %q, %t, want %q, %t", tt.src, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAPRSReportInterval(t *testing.T) {
+	g := newAPRSGateway("localhost:14580", "N0CALL", "-1", time.Minute)
+	start := time.Now()
+	tests := []struct {
+		src   string
+		after time.Duration
+		sent  bool
+	}{
+		{"KC1AWV", 0, true},
+		{"KC1AWV", 30 * time.Second, false},
+		{"N0CALL", 30 * time.Second, true},
+		{"KC1AWV", time.Minute, true},
+		{"KC1AWV/P", time.Minute, false},
+	}
+	for i, tt := range tests {
+		g.report(tt.src, Position{Latitude: 42.5, Longitude: -71.25}, start.Add(tt.after))
+		sent := len(g.queue) == 1
+		if sent {
+			<-g.queue
+		}
+		if sent != tt.sent {
+			t.Errorf("report #%d from %s sent %t, want %t", i, tt.src, sent, tt.sent)
+		}
+	}
+}
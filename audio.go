@@ -0,0 +1,217 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+// resamplerCutoff is the antialiasing cutoff as a fraction of the output
+// sample rate, just below its Nyquist frequency
+const resamplerCutoff = 0.45
+
+// resampler converts a stream of audio between sample rates using linear
+// interpolation. Its position and the last input sample carry over from one
+// chunk to the next, so chunk boundaries don't click. When downsampling the
+// input is low-pass filtered first, so frequencies the output rate cannot
+// carry don't alias. It keeps state between calls, so use one per output.
+type resampler struct {
+	step    float64  // input samples per output sample
+	pos     float64  // position of the next output sample; -1 is the last sample of the previous chunk
+	last    float64  // last input sample of the previous chunk
+	lowPass []biquad // antialiasing filter sections, when downsampling
+}
+
+// newResampler creates a resampler from one sample rate to another
+func newResampler(from, to int) *resampler {
+	r := &resampler{step: float64(from) / float64(to)}
+	if to < from {
+		// Fourth-order Butterworth response from two sections
+		cutoff := resamplerCutoff * float64(to)
+		r.lowPass = []biquad{
+			newLowPassBiquad(cutoff, float64(from), 0.5412),
+			newLowPassBiquad(cutoff, float64(from), 1.3066),
+		}
+	}
+	return r
+}
+
+// resample returns the output for the next chunk of input. The output lags
+// the input by up to one input sample, which comes out with the next chunk.
+func (r *resampler) resample(in []int16) []int16 {
+	if r.step == 1 || len(in) == 0 {
+		return in
+	}
+
+	x := make([]float64, len(in))
+	for i, sample := range in {
+		v := float64(sample)
+		for j := range r.lowPass {
+			v = r.lowPass[j].filter(v)
+		}
+		x[i] = v
+	}
+	at := func(j int) float64 {
+		if j < 0 {
+			return r.last
+		}
+		return x[j]
+	}
+
+	out := make([]int16, 0, int(float64(len(x))/r.step)+1)
+	for ; r.pos < float64(len(x)-1); r.pos += r.step {
+		j := int(math.Floor(r.pos))
+		frac := r.pos - float64(j)
+		a, b := at(j), at(j+1)
+		v := math.Round(a + (b-a)*frac)
+		out = append(out, int16(max(math.MinInt16, min(v, math.MaxInt16))))
+	}
+	r.pos -= float64(len(x))
+	r.last = x[len(x)-1]
+
+	return out
+}
+
+// biquad is a second-order low-pass filter section, from the Audio EQ Cookbook
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// newLowPassBiquad creates a low-pass section with the given cutoff, sample
+// rate and Q
+func newLowPassBiquad(cutoff, sampleRate, q float64) biquad {
+	w := 2 * math.Pi * cutoff / sampleRate
+	alpha := math.Sin(w) / (2 * q)
+	cos := math.Cos(w)
+	a0 := 1 + alpha
+	return biquad{
+		b0: (1 - cos) / 2 / a0,
+		b1: (1 - cos) / a0,
+		b2: (1 - cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// filter returns the filtered value of the next sample
+func (f *biquad) filter(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// duplicateChannels copies each mono sample into every output channel,
+// interleaved as oto expects (left, right, left, right... for stereo)
+func duplicateChannels(in []int16, channels int) []int16 {
+	if channels <= 1 {
+		return in
+	}
+
+	out := make([]int16, len(in)*channels)
+	for i, sample := range in {
+		for ch := 0; ch < channels; ch++ {
+			out[i*channels+ch] = sample
+		}
+	}
+	return out
+}
+
+// applyGain scales samples by gain, clamping to the int16 range so loud
+// audio clips rather than wrapping around
+func applyGain(samples []int16, gain float64) []int16 {
+	if gain == 1 {
+		return samples
+	}
+
+	out := make([]int16, len(samples))
+	for i, sample := range samples {
+		v := math.Round(float64(sample) * gain)
+		out[i] = int16(max(math.MinInt16, min(v, math.MaxInt16)))
+	}
+	return out
+}
+
+// highPassCutoff is the corner frequency of the DC blocking filter in Hz
+const highPassCutoff = 100
+
+// highPass is a single-pole high-pass filter that removes DC offset. It keeps
+// state between calls, so use one per stream.
+type highPass struct {
+	alpha float64
+	prevX float64
+	prevY float64
+}
+
+// newHighPass creates a high-pass filter for the given cutoff and sample rate
+func newHighPass(cutoff, sampleRate float64) *highPass {
+	rc := 1 / (2 * math.Pi * cutoff)
+	return &highPass{alpha: rc / (rc + 1/sampleRate)}
+}
+
+// filter returns the filtered samples
+func (f *highPass) filter(samples []int16) []int16 {
+	out := make([]int16, len(samples))
+	for i, sample := range samples {
+		x := float64(sample)
+		y := f.alpha * (f.prevY + x - f.prevX)
+		f.prevX, f.prevY = x, y
+		out[i] = int16(max(math.MinInt16, min(math.Round(y), math.MaxInt16)))
+	}
+	return out
+}
+
+// silence returns the samples for a number of missing stream frames
+func silence(frames int) []int16 {
+	return make([]int16, min(frames, maxGapFrames)*samplesPerFrame)
+}
+
+// levelBarWidth is the width of the level meter bar in characters
+const levelBarWidth = 20
+
+// levels returns the RMS and peak level of samples relative to full scale
+func levels(samples []int16) (rms, peak float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, sample := range samples {
+		v := float64(sample) / math.MaxInt16
+		sum += v * v
+		peak = max(peak, math.Abs(v))
+	}
+	return math.Sqrt(sum / float64(len(samples))), peak
+}
+
+// dBFS converts a level relative to full scale to decibels
+func dBFS(level float64) float64 {
+	if level <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(level)
+}
+
+// levelBar draws a meter for a level, scaled over a 60 dB range
+func levelBar(level float64) string {
+	n := int(math.Round((dBFS(level) + 60) / 60 * levelBarWidth))
+	n = max(0, min(n, levelBarWidth))
+	return strings.Repeat("#", n) + strings.Repeat("-", levelBarWidth-n)
+}
@@ -0,0 +1,271 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// tone returns n samples of a sine wave at freq Hz sampled at rate Hz
+func tone(n int, freq, rate float64) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(10000 * math.Sin(2*math.Pi*freq*float64(i)/rate+0.1))
+	}
+	return samples
+}
+
+// risingCrossings counts the times samples cross zero going upwards
+func risingCrossings(samples []int16) int {
+	n := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1] < 0 && samples[i] >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// resampleChunks resamples in as a stream of chunks of the given size
+func resampleChunks(in []int16, chunk, from, to int) []int16 {
+	r := newResampler(from, to)
+	var out []int16
+	for len(in) > 0 {
+		n := min(chunk, len(in))
+		out = append(out, r.resample(in[:n])...)
+		in = in[n:]
+	}
+	return out
+}
+
+// rms returns the root mean square level of samples
+func rms(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestResample(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       int
+		from, to int
+		want     int
+	}{
+		{"same rate", 320, 8000, 8000, 320},
+		{"to 48 kHz", 320, 8000, 48000, 1920},
+		{"to 44.1 kHz", 320, 8000, 44100, 1764},
+		{"to 16 kHz", 160, 8000, 16000, 320},
+		{"to 4 kHz", 320, 8000, 4000, 160},
+		{"empty", 0, 8000, 48000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The output lags by up to one input sample
+			out := newResampler(tt.from, tt.to).resample(tone(tt.in, 1000, float64(tt.from)))
+			if lag := tt.want - len(out); lag < 0 || lag > max(tt.to/tt.from, 1) {
+				t.Errorf("resample of %d samples from %d to %d Hz gave %d, want %d", tt.in, tt.from, tt.to, len(out), tt.want)
+			}
+		})
+	}
+}
+
+func TestResampleChunks(t *testing.T) {
+	// Codec 2 frames are 160 samples; a stream of them must resample the same
+	// as the whole call at once, with no drift or clicks at the boundaries
+	for _, to := range []int{48000, 44100, 16000, 4000} {
+		in := tone(8000, 1000, 8000)
+		whole := newResampler(8000, to).resample(in)
+		chunked := resampleChunks(in, 160, 8000, to)
+
+		if d := len(whole) - len(chunked); d < -1 || d > 1 {
+			t.Fatalf("%d Hz: chunked resample gave %d samples, whole gave %d", to, len(chunked), len(whole))
+		}
+		if ideal := 8000 * to / 8000; math.Abs(float64(len(chunked)-ideal)) > float64(max(to/8000, 1)) {
+			t.Errorf("%d Hz: one second resampled in chunks gave %d samples, want about %d", to, len(chunked), ideal)
+		}
+		for i := range min(len(whole), len(chunked)) {
+			if d := int(whole[i]) - int(chunked[i]); d < -1 || d > 1 {
+				t.Fatalf("%d Hz: sample %d is %d in chunks, %d whole", to, i, chunked[i], whole[i])
+			}
+		}
+	}
+}
+
+func TestResampleKeepsFrequency(t *testing.T) {
+	// One second of each tone, so the rising zero crossings count its cycles
+	for _, to := range []int{48000, 44100} {
+		for _, freq := range []float64{300, 1000, 3000} {
+			out := resampleChunks(tone(8000, freq, 8000), 160, 8000, to)
+			if n := risingCrossings(out); math.Abs(float64(n)-freq) > 1 {
+				t.Errorf("%g Hz tone resampled to %d Hz has %d cycles a second", freq, to, n)
+			}
+		}
+	}
+}
+
+func TestResampleAntialias(t *testing.T) {
+	// Downsampling to 4 kHz must pass tones below 2 kHz and stop those above
+	tests := []struct {
+		freq float64
+		pass bool
+	}{
+		{300, true},
+		{1000, true},
+		{3500, false},
+	}
+	for _, tt := range tests {
+		in := tone(8000, tt.freq, 8000)
+		// Skip the filter settling at the start
+		out := resampleChunks(in, 160, 8000, 4000)[400:]
+		gain := 20 * math.Log10(rms(out)/rms(in))
+		if tt.pass && gain < -3 {
+			t.Errorf("%g Hz tone downsampled to 4 kHz lost %.1f dB", tt.freq, -gain)
+		}
+		if !tt.pass && gain > -20 {
+			t.Errorf("%g Hz tone downsampled to 4 kHz only lost %.1f dB, aliasing", tt.freq, -gain)
+		}
+	}
+}
+
+func TestSilence(t *testing.T) {
+	tests := []struct {
+		frames int
+		want   int
+	}{
+		{0, 0},
+		{1, samplesPerFrame},
+		{2, 2 * samplesPerFrame},
+		{maxGapFrames, maxGapFrames * samplesPerFrame},
+		{maxGapFrames + 1, maxGapFrames * samplesPerFrame},
+	}
+	for _, tt := range tests {
+		if got := silence(tt.frames); len(got) != tt.want {
+			t.Errorf("silence(%d) gave %d samples, want %d", tt.frames, len(got), tt.want)
+		}
+	}
+}
+
+func TestApplyGain(t *testing.T) {
+	tests := []struct {
+		name string
+		gain float64
+		in   []int16
+		want []int16
+	}{
+		{"unity", 1, []int16{-32768, -1, 0, 1, 32767}, []int16{-32768, -1, 0, 1, 32767}},
+		{"double", 2, []int16{-1000, 0, 1000}, []int16{-2000, 0, 2000}},
+		{"half", 0.5, []int16{-1001, 3, 1001}, []int16{-501, 2, 501}},
+		{"clamp high", 2, []int16{16384, 20000, 32767}, []int16{32767, 32767, 32767}},
+		{"clamp low", 2, []int16{-16384, -16385, -32768}, []int16{-32768, -32768, -32768}},
+		{"just below the limit", 2, []int16{16383, -16383}, []int16{32766, -32766}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyGain(tt.in, tt.gain); !slices.Equal(got, tt.want) {
+				t.Errorf("applyGain(%v, %g) = %v, want %v", tt.in, tt.gain, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighPass(t *testing.T) {
+	tests := []struct {
+		name string
+		dc   int16
+	}{
+		{"positive offset", 8000},
+		{"negative offset", -8000},
+		{"full scale", 32767},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHighPass(highPassCutoff, codec2SampleRate)
+			in := make([]int16, samplesPerFrame)
+			for i := range in {
+				in[i] = tt.dc
+			}
+
+			// The filter keeps its state between frames, so a steady
+			// offset decays across them rather than restarting each frame
+			var out []int16
+			for i := 0; i < 5; i++ {
+				out = f.filter(in)
+			}
+			if last := out[len(out)-1]; math.Abs(float64(last)) > math.Abs(float64(tt.dc))/100 {
+				t.Errorf("DC input of %d filtered to %d after 200 ms, want under 1%%", tt.dc, last)
+			}
+		})
+	}
+}
+
+func TestHighPassPerStream(t *testing.T) {
+	c, _ := newTestClient(t, Config{HighPass: true})
+	for id := uint16(1); id <= 2; id++ {
+		c.handleStreamFrame("", makeFrame(t, id, "N0CALL", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize)))
+	}
+
+	// Each stream carries its own filter state, so one stream's audio
+	// doesn't bleed into the start of the next
+	a, b := c.streams.streams[streamKey{"", 1}], c.streams.streams[streamKey{"", 2}]
+	if a == nil || b == nil {
+		t.Fatal("streams not tracked")
+	}
+	if a, b := a.highPass, b.highPass; a == nil || b == nil || a == b {
+		t.Errorf("streams have filters %p and %p, want one each", a, b)
+	}
+}
+
+func TestDuplicateChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       []int16
+		channels int
+		want     []int16
+	}{
+		{"mono", []int16{1, -2, 3}, 1, []int16{1, -2, 3}},
+		{"stereo", []int16{1, -2, 3}, 2, []int16{1, 1, -2, -2, 3, 3}},
+		{"empty stereo", nil, 2, []int16{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := duplicateChannels(tt.in, tt.channels); !slices.Equal(got, tt.want) {
+				t.Errorf("duplicateChannels(%v, %d) = %v, want %v", tt.in, tt.channels, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidChannels(t *testing.T) {
+	for _, channels := range []int{0, 3, -1} {
+		c, err := newClient(Config{SampleRate: 48000, Channels: channels, AudioBuffer: 100, Gain: 1, StreamTimeout: DefaultStreamTimeout})
+		if err == nil {
+			c.Close()
+			t.Errorf("newClient with %d channels succeeded, want an error", channels)
+		} else if !strings.Contains(err.Error(), "channel") {
+			t.Errorf("newClient with %d channels: %v, want a channel count error", channels, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Audio stream settings
+const (
+	audioStreamTick    = frameDuration        // one M17 stream frame of audio
+	audioStreamBacklog = 2 * codec2SampleRate // samples buffered before old audio is discarded
+	audioClientBuffer  = 50                   // chunks queued for a slow listener before dropping
+)
+
+// audioStreamer paces decoded audio into a continuous 8 kHz stream for HTTP
+// listeners, filling the time between transmissions with silence
+type audioStreamer struct {
+	mu      sync.Mutex
+	pending []int16
+	clients map[chan []byte]struct{}
+}
+
+// newAudioStreamer creates an audio streamer with no listeners
+func newAudioStreamer() *audioStreamer {
+	return &audioStreamer{clients: make(map[chan []byte]struct{})}
+}
+
+// feed queues decoded audio for the stream without blocking the decoder
+func (a *audioStreamer) feed(samples []int16) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending = append(a.pending, samples...)
+	if over := len(a.pending) - audioStreamBacklog; over > 0 {
+		a.pending = a.pending[over:]
+	}
+}
+
+// HandleFrame queues the frame audio for the stream
+func (a *audioStreamer) HandleFrame(f *Frame) {
+	a.feed(f.Audio)
+}
+
+// run sends one frame of audio, or silence, to every listener per tick until
+// the context is cancelled
+func (a *audioStreamer) run(ctx context.Context) {
+	ticker := time.NewTicker(audioStreamTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.tick()
+		}
+	}
+}
+
+// tick broadcasts the next frame of audio
+func (a *audioStreamer) tick() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	chunk := make([]int16, samplesPerFrame)
+	n := copy(chunk, a.pending)
+	a.pending = a.pending[n:]
+	if len(a.clients) == 0 {
+		return
+	}
+
+	buf := pcmBytes(chunk)
+	for send := range a.clients {
+		select {
+		case send <- buf:
+		default:
+			slog.Debug("dropping audio for slow stream listener")
+		}
+	}
+}
+
+// serveStream streams audio to an HTTP client as an endless WAV file
+func (a *audioStreamer) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	send := make(chan []byte, audioClientBuffer)
+	a.mu.Lock()
+	a.clients[send] = struct{}{}
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.clients, send)
+		a.mu.Unlock()
+	}()
+
+	slog.Info("audio stream listener connected", "remote", r.RemoteAddr)
+	defer slog.Info("audio stream listener disconnected", "remote", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Header().Set("Cache-Control", "no-cache")
+	// The stream has no end, so claim the largest size a WAV header allows
+	if _, err := w.Write(wavHeader(codec2SampleRate, 0xFFFFFFFF-36)); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case buf := <-send:
+			if _, err := w.Write(buf); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// serveAudioStream starts an HTTP server streaming decoded audio
+func (c *Client) serveAudioStream(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", c.streamer.serveStream)
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("audio stream server failed", "err", err)
+		}
+	}()
+
+	return srv, nil
+}
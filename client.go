@@ -20,10 +20,21 @@ package main
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go-m17gateway-monitor/codec2"
+	"go-m17gateway-monitor/m17"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
@@ -31,63 +42,733 @@ import (
 	"github.com/hajimehoshi/oto"
 )
 
-// Packet MAGIC constants
+// anyInterface is the Linux pseudo-interface capturing on all interfaces
+const anyInterface = "any"
+
+// DefaultPort is the UDP port used by M17 reflectors
+const DefaultPort = 17010
+
+// DefaultSnaplen is the default capture snapshot length, enough for any
+// M17 frame in a standard Ethernet packet
+const DefaultSnaplen = 1600
+
+// maxSnaplen is the largest snapshot length libpcap accepts
+const maxSnaplen = 262144
+
+// Audio defaults
+const (
+	codec2SampleRate   = 8000 // Codec 2 always produces 8 kHz audio
+	DefaultAudioBuffer = 8192 // oto buffer size in bytes
+	DefaultSilence     = 200  // ms of silence played between transmissions
+	playbackQueue      = 50   // chunks of audio queued for the device before dropping the oldest
+)
+
+// Device open retry backoff
+const (
+	retryInitialDelay = time.Second
+	retryMaxDelay     = 30 * time.Second
+)
+
+// Stream frame layout and timing. A 16-byte voice payload holds two 20 ms
+// Codec 2 3200 bps frames, giving 40 ms of 8 kHz audio per stream frame.
 const (
-	MagicM17 = "M17 "
+	codec2FramesPerPayload = 2
+	bytesPerCodec2Frame    = 8   // 64 bits at 3200 bps
+	samplesPerCodec2Frame  = 160 // 20 ms at 8 kHz
+	payloadSize            = codec2FramesPerPayload * bytesPerCodec2Frame
+	samplesPerFrame        = codec2FramesPerPayload * samplesPerCodec2Frame
+	frameDurationMs        = samplesPerFrame * 1000 / codec2SampleRate
+	frameDuration          = frameDurationMs * time.Millisecond
+	maxGapFrames           = 25 // cap on silence inserted for a single gap (1 s)
 )
 
+// voiceDecoder decodes Codec 2 frames. It is satisfied by *codec2.Codec2 and
+// lets tests substitute a decoder that fails.
+type voiceDecoder interface {
+	Decode(bits []byte) ([]int16, error)
+	ModeName() string
+	BytesPerFrame() int
+	Close()
+}
+
 // Client represents a M17 client
 type Client struct {
-	handle *pcap.Handle
-	codec2 *codec2.Codec2
-	player *oto.Player
-	ctx    context.Context
-	cancel context.CancelFunc
+	cfg       Config
+	source    packetSource
+	reflector *reflector
+	socket    *net.UDPConn
+	codec2    voiceDecoder
+	audio     *oto.Context
+	player    *oto.Player
+	playback  chan []int16
+	played    chan struct{}
+	offline   bool
+	handler   FrameHandler
+	sinks     frameSinks
+	streams   *streamTracker
+	heard     *lastHeard
+	roster    *roster
+	notify    *notifier
+	db        *heardDB
+	dstFilter callsignFilter
+	srcFilter callsignFilter
+	aesKey    *aesKey
+	scrambler *scramblerKey
+	pcmOut    *pcmWriter
+	opusOut   *opusWriter
+	dedup     *dedupWindow
+	badSizes  sync.Map
+	reserved  atomic.Bool
+	jitter    *jitterBuffer
+	tui       *tui
+	events    *eventEmitter
+	metrics   metrics
+	eventSeq  atomic.Uint64
+	paused    atomic.Bool
+	started   time.Time
+	web       *webHub
+	mqtt      *mqttPublisher
+	aprs      *aprsGateway
+	streamer  *audioStreamer
+	servers   []*http.Server
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	once      sync.Once
 }
 
-// NewClient creates a new M17 client
-func NewClient(interfaceName string) (*Client, error) {
+// NewClient creates a new M17 client capturing live traffic
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.Interface == "" {
+		return nil, fmt.Errorf("no capture interface specified (available: %s)", availableInterfaces())
+	}
+	if cfg.Interface == anyInterface && runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("the %q pseudo-interface is only supported on Linux", anyInterface)
+	}
+	filter, err := captureFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// Open device for packet capture
-	handle, err := pcap.OpenLive(interfaceName, 1600, true, pcap.BlockForever)
+	if cfg.Snaplen <= 0 || cfg.Snaplen > maxSnaplen {
+		return nil, fmt.Errorf("invalid snapshot length %d: must be 1-%d", cfg.Snaplen, maxSnaplen)
+	}
+	handle, err := openLive(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open device %q: %w (available: %s)", cfg.Interface, err, availableInterfaces())
+	}
+
+	return newCaptureClient(handle, filter, cfg)
+}
+
+// openLive opens the capture device, retrying up to cfg.Retry more times with
+// exponential backoff so the device has a chance to come up at boot
+func openLive(cfg Config) (*pcap.Handle, error) {
+	delay := retryInitialDelay
+	for attempt := 0; ; attempt++ {
+		handle, err := pcap.OpenLive(cfg.Interface, int32(cfg.Snaplen), cfg.Promisc, pcap.BlockForever)
+		if err == nil || attempt >= cfg.Retry {
+			return handle, err
+		}
+
+		slog.Warn("failed to open device, retrying", "iface", cfg.Interface, "attempt", attempt+1, "retries", cfg.Retry, "delay", delay, "err", err)
+		time.Sleep(delay)
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// NewClientFromFile creates a new M17 client replaying a capture file
+func NewClientFromFile(path string, cfg Config) (*Client, error) {
+	filter, err := captureFilter(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open device: %w", err)
+		return nil, err
 	}
 
-	// Set BPF filter to capture only UDP packets on port 17010
-	err = handle.SetBPFFilter("udp port 17010")
+	handle, err := pcap.OpenOffline(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to set BPF filter: %w", err)
+		return nil, fmt.Errorf("failed to open capture file %q: %w", path, err)
+	}
+
+	c, err := newCaptureClient(handle, filter, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.offline = true
+	return c, nil
+}
+
+// NewClientFromReflector creates a new M17 client linked directly to a
+// reflector module, without needing packet capture privileges
+func NewClientFromReflector(cfg Config) (*Client, error) {
+	if cfg.PingTimeout <= 0 {
+		return nil, fmt.Errorf("invalid ping timeout %d: must be positive", cfg.PingTimeout)
+	}
+
+	r, err := dialReflector(cfg.Connect, cfg.Callsign, cfg.Module)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+	c.reflector = r
+
+	return c, nil
+}
+
+// validatePort checks that a UDP port is in range
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid UDP port %d: must be between 1 and 65535", port)
+	}
+	return nil
+}
+
+// parsePort parses and validates a single UDP port
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid UDP port %q", s)
+	}
+	return port, validatePort(port)
+}
+
+// portFilter builds a BPF filter from a comma-separated list of ports and
+// port ranges, e.g. "17010,17020-17029". The udp primitive matches UDP over
+// both IPv4 and IPv6.
+func portFilter(spec string) (string, error) {
+	var terms []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := parsePort(lo)
+		if err != nil {
+			return "", err
+		}
+		if !isRange {
+			terms = append(terms, fmt.Sprintf("udp port %d", first))
+			continue
+		}
+
+		last, err := parsePort(hi)
+		if err != nil {
+			return "", err
+		}
+		if last < first {
+			return "", fmt.Errorf("invalid UDP port range %q", part)
+		}
+		terms = append(terms, fmt.Sprintf("udp portrange %d-%d", first, last))
+	}
+
+	if len(terms) == 0 {
+		return "", errors.New("no UDP ports specified")
+	}
+	return strings.Join(terms, " or "), nil
+}
+
+// captureFilter builds the BPF filter for a capture. A custom -bpf expression
+// narrows the port filter, or replaces it with -bpf-replace. The result is
+// compiled up front so a malformed expression is reported rather than
+// leaving the capture unfiltered.
+func captureFilter(cfg Config) (string, error) {
+	var filter string
+	switch {
+	case cfg.BPFReplace:
+		if cfg.BPF == "" {
+			return "", errors.New("-bpf-replace needs a -bpf filter")
+		}
+		filter = cfg.BPF
+	case cfg.BPF != "":
+		ports, err := portFilter(cfg.Ports)
+		if err != nil {
+			return "", err
+		}
+		filter = fmt.Sprintf("(%s) and (%s)", ports, cfg.BPF)
+	default:
+		return portFilter(cfg.Ports)
+	}
+
+	if _, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, DefaultSnaplen, filter); err != nil {
+		return "", fmt.Errorf("invalid BPF filter %q: %w", filter, err)
+	}
+	return filter, nil
+}
+
+// linkTypeSupported reports whether gopacket can decode a capture link type
+func linkTypeSupported(linkType layers.LinkType) bool {
+	return layers.LinkTypeMetadata[linkType].Name != "UnknownLinkType"
+}
+
+// packetSource supplies captured packets to a client. Closing it ends the
+// packet channel.
+type packetSource interface {
+	Packets() chan gopacket.Packet
+	Close()
+}
+
+// pcapSource reads packets from a live or file capture handle
+type pcapSource struct {
+	handle *pcap.Handle
+	*gopacket.PacketSource
+}
+
+// newPcapSource creates a packet source decoding the handle's link type
+func newPcapSource(handle *pcap.Handle) *pcapSource {
+	return &pcapSource{
+		handle:       handle,
+		PacketSource: gopacket.NewPacketSource(handle, handle.LinkType()),
+	}
+}
+
+// Close closes the capture handle
+func (p *pcapSource) Close() {
+	p.handle.Close()
+}
+
+// newCaptureClient creates a client reading packets from a capture handle
+func newCaptureClient(handle *pcap.Handle, filter string, cfg Config) (*Client, error) {
+	// Captures on "any" use the Linux cooked (SLL) header instead of Ethernet,
+	// which gopacket decodes like any other link layer
+	linkType := handle.LinkType()
+	if !linkTypeSupported(linkType) {
+		handle.Close()
+		return nil, fmt.Errorf("unsupported capture link type %d", linkType)
+	}
+	slog.Debug("capture opened", "linkType", linkType)
+
+	// Set BPF filter to capture only UDP packets on the M17 ports
+	if err := handle.SetBPFFilter(filter); err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("failed to set BPF filter %q: %w", filter, err)
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+	c.source = newPcapSource(handle)
+
+	return c, nil
+}
+
+// newClient sets up decoding and playback
+func newClient(cfg Config) (*Client, error) {
+	// Dumping never decodes audio, so there is nothing to play
+	if cfg.Dump {
+		cfg.NoSound = true
+	}
+	if !cfg.NoSound {
+		if cfg.SampleRate <= 0 {
+			return nil, fmt.Errorf("invalid sample rate %d: must be positive", cfg.SampleRate)
+		}
+		if cfg.Channels != 1 && cfg.Channels != 2 {
+			return nil, fmt.Errorf("invalid channel count %d: must be 1 or 2", cfg.Channels)
+		}
+		if cfg.AudioBuffer <= 0 {
+			return nil, fmt.Errorf("invalid audio buffer size %d: must be positive", cfg.AudioBuffer)
+		}
+		if cfg.Gain <= 0 {
+			return nil, fmt.Errorf("invalid gain %g: must be positive", cfg.Gain)
+		}
+		if cfg.Silence < 0 {
+			return nil, fmt.Errorf("invalid silence %d ms: must not be negative", cfg.Silence)
+		}
+	}
+	if cfg.StreamTimeout <= 0 {
+		return nil, fmt.Errorf("invalid stream timeout %d ms: must be positive", cfg.StreamTimeout)
+	}
+	var key *aesKey
+	if cfg.AESKey != "" {
+		var err error
+		if key, err = newAESKey(cfg.AESKey); err != nil {
+			return nil, fmt.Errorf("invalid AES key: %w", err)
+		}
+	}
+	var scramblerKey *scramblerKey
+	if cfg.ScrambleKey != "" {
+		var err error
+		if scramblerKey, err = newScramblerKey(cfg.ScrambleKey); err != nil {
+			return nil, fmt.Errorf("invalid scrambler key: %w", err)
+		}
+	}
+	if cfg.PCMOut == "-" && cfg.JSON {
+		return nil, errors.New("-pcmout - cannot share stdout with -json")
+	}
+	if cfg.OpusOut == "-" && (cfg.JSON || cfg.PCMOut == "-") {
+		return nil, errors.New("-opusout - cannot share stdout with -json or -pcmout -")
+	}
+	if cfg.APRSServer != "" && (cfg.APRSCall == "" || cfg.APRSPass == "") {
+		return nil, errors.New("-aprs-server needs -aprs-call and -aprs-pass")
+	}
+	if cfg.TUI && (cfg.JSON || cfg.Dump || cfg.PCMOut == "-" || cfg.OpusOut == "-") {
+		return nil, errors.New("-tui needs the terminal to itself: it cannot be used with -json, -dump or output to stdout")
+	}
+	if cfg.RecordDir != "" {
+		if err := os.MkdirAll(cfg.RecordDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create recording directory: %w", err)
+		}
+	}
+	var names *roster
+	if cfg.Roster != "" {
+		var err error
+		if names, err = loadRoster(cfg.Roster); err != nil {
+			return nil, err
+		}
+		slog.Info("loaded roster", "path", cfg.Roster, "callsigns", names.size())
 	}
 
 	// Initialize Codec 2 at 3200 bps
+	codec2Version := codec2.Version()
+	if codec2Version == "" {
+		codec2Version = "unknown"
+	}
 	codec2, err := codec2.New(codec2.MODE_3200)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize codec2: %w", err)
 	}
-
-	// Initialize Oto context and player
-	ctx, err := oto.NewContext(8000, 1, 2, 8192)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create oto context: %w", err)
+	if err := checkCodec2Framing(codec2.BytesPerFrame(), codec2.SamplesPerFrame()); err != nil {
+		codec2.Close()
+		return nil, err
 	}
+	slog.Debug("codec2 initialized",
+		"version", codec2Version,
+		"mode", codec2.ModeName(),
+		"samplesPerFrame", codec2.SamplesPerFrame(),
+		"bytesPerFrame", codec2.BytesPerFrame(),
+	)
 
-	player := ctx.NewPlayer()
+	// Initialize Oto context and player unless running headless. Without an
+	// audio device we carry on monitoring with playback disabled.
+	var audio *oto.Context
+	var player *oto.Player
+	if !cfg.NoSound {
+		if cfg.AudioDevice != "" {
+			selectAudioDevice(cfg.AudioDevice)
+		}
+		audio, err = oto.NewContext(cfg.SampleRate, cfg.Channels, 2, cfg.AudioBuffer)
+		if err != nil {
+			slog.Warn("failed to open audio device, continuing without playback", "err", err)
+			audio = nil
+		} else {
+			player = audio.NewPlayer()
+		}
+	}
 
 	clientCtx, cancel := context.WithCancel(context.Background())
 
-	return &Client{
-		handle: handle,
-		codec2: codec2,
-		player: player,
-		ctx:    clientCtx,
-		cancel: cancel,
-	}, nil
+	c := &Client{
+		cfg:       cfg,
+		codec2:    codec2,
+		audio:     audio,
+		player:    player,
+		streams:   newStreamTracker(time.Duration(cfg.StreamTimeout) * time.Millisecond),
+		heard:     newLastHeard(lastHeardSize),
+		roster:    names,
+		dstFilter: newCallsignFilter(cfg.DstAllow, cfg.DstDeny),
+		srcFilter: newCallsignFilter(cfg.SrcAllow, cfg.SrcDeny),
+		aesKey:    key,
+		scrambler: scramblerKey,
+		events:    newEventEmitter(cfg.JSON, os.Stdout),
+		started:   time.Now(),
+		ctx:       clientCtx,
+		cancel:    cancel,
+	}
+	c.handler = playbackHandler{c}
+	if player != nil {
+		c.playback = make(chan []int16, playbackQueue)
+		c.played = make(chan struct{})
+		go c.runPlayback()
+	}
+	if cfg.NotifySrc != "" {
+		c.notify = newNotifier(cfg.NotifySrc)
+	}
+	if cfg.Dedup > 0 {
+		c.dedup = newDedupWindow(time.Duration(cfg.Dedup) * time.Millisecond)
+	}
+	if cfg.Jitter > 0 {
+		c.jitter = newJitterBuffer(cfg.Jitter)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.releaseJitter()
+		}()
+	}
+
+	if cfg.PCMOut != "" {
+		order, err := pcmByteOrder(cfg.PCMEndian)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if c.pcmOut, err = newPCMWriter(cfg.PCMOut, order); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.AddFrameHandler(c.pcmOut)
+	}
+	if cfg.OpusOut != "" {
+		if c.opusOut, err = newOpusWriter(cfg.OpusOut, cfg.SampleRate, cfg.OpusBitrate); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.AddFrameHandler(c.opusOut)
+	}
+	if cfg.HeardFile != "" {
+		if err := c.heard.load(cfg.HeardFile); err != nil {
+			slog.Warn("starting with an empty last heard list", "err", err)
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.saveHeard()
+		}()
+	}
+	if cfg.DBPath != "" {
+		if c.db, err = openHeardDB(cfg.DBPath); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if cfg.MetricsAddr != "" {
+		srv, err := c.serveMetrics(cfg.MetricsAddr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.servers = append(c.servers, srv)
+	}
+	if cfg.MQTTBroker != "" {
+		c.mqtt = newMQTTPublisher(cfg.MQTTBroker, cfg.MQTTTopic)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.mqtt.run(c.ctx)
+		}()
+	}
+	if cfg.APRSServer != "" {
+		c.aprs = newAPRSGateway(cfg.APRSServer, cfg.APRSCall, cfg.APRSPass, time.Duration(cfg.APRSInterval)*time.Second)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.aprs.run(c.ctx)
+		}()
+	}
+	if cfg.APIAddr != "" {
+		srv, err := c.serveAPI(cfg.APIAddr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.servers = append(c.servers, srv)
+	}
+	if cfg.WebAddr != "" {
+		c.web = newWebHub()
+		srv, err := c.serveWeb(cfg.WebAddr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.servers = append(c.servers, srv)
+	}
+	if cfg.StreamAddr != "" {
+		c.streamer = newAudioStreamer()
+		c.AddFrameHandler(c.streamer)
+		srv, err := c.serveAudioStream(cfg.StreamAddr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.servers = append(c.servers, srv)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.streamer.run(c.ctx)
+		}()
+	}
+
+	if cfg.Stats > 0 {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.logThroughput(time.Duration(cfg.Stats) * time.Second)
+		}()
+	}
+	if cfg.Heartbeat > 0 {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.heartbeat(time.Duration(cfg.Heartbeat) * time.Second)
+		}()
+	}
+	if cfg.TUI {
+		if c.tui, err = newTUI(c); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.tui.run(c.ctx)
+		}()
+	}
+
+	return c, nil
+}
+
+// checkCodec2Framing verifies that the codec frame size matches the layout of
+// the M17 voice payload, which the decode path relies on
+func checkCodec2Framing(bytesPerFrame, samples int) error {
+	if bytesPerFrame != bytesPerCodec2Frame || samples != samplesPerCodec2Frame {
+		return fmt.Errorf("codec2 uses %d-byte frames of %d samples, but M17 voice payloads need %d-byte frames of %d samples",
+			bytesPerFrame, samples, bytesPerCodec2Frame, samplesPerCodec2Frame)
+	}
+	return nil
+}
+
+// selectAudioDevice asks the sound system to play through the named output.
+// oto always opens the default device, so on Linux this sets PULSE_SINK,
+// which routes the default ALSA device when it is PulseAudio or PipeWire.
+// Elsewhere there is no way to choose, so it only warns.
+func selectAudioDevice(name string) {
+	if runtime.GOOS != "linux" {
+		slog.Warn("selecting an audio device is not supported on this platform, using the default", "audiodev", name)
+		return
+	}
+	if sink, ok := os.LookupEnv("PULSE_SINK"); ok && sink != name {
+		slog.Warn("-audiodev overrides PULSE_SINK", "audiodev", name, "PULSE_SINK", sink)
+	}
+	if err := os.Setenv("PULSE_SINK", name); err != nil {
+		slog.Warn("failed to select audio device, using the default", "audiodev", name, "err", err)
+		return
+	}
+	slog.Info("selected audio device through PULSE_SINK; plain ALSA without PulseAudio or PipeWire ignores it", "audiodev", name)
+}
+
+// availableInterfaces returns a comma-separated list of capture interfaces
+func availableInterfaces() string {
+	devs, err := pcap.FindAllDevs()
+	if err != nil || len(devs) == 0 {
+		return "none found"
+	}
+
+	names := make([]string, 0, len(devs))
+	for _, dev := range devs {
+		names = append(names, dev.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// start runs the listen loop in the background
+func (c *Client) start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.listen()
+	}()
+}
+
+// Close stops the client and releases the capture, codec and audio resources.
+// It is safe to call more than once.
+func (c *Client) Close() {
+	c.once.Do(func() {
+		c.cancel()
+		for _, srv := range c.servers {
+			srv.Close()
+		}
+		if c.source != nil {
+			c.source.Close()
+		}
+		if c.reflector != nil {
+			c.reflector.close()
+		}
+		if c.socket != nil {
+			c.socket.Close()
+		}
+		c.wg.Wait()
+		if c.playback != nil {
+			// Nothing else can queue audio now, so let playback finish
+			close(c.playback)
+			<-c.played
+		}
+		if c.tui != nil {
+			c.tui.close()
+		}
+
+		for _, s := range c.streams.drain() {
+			c.finishStream(s, true)
+		}
+
+		if c.pcmOut != nil {
+			if err := c.pcmOut.Close(); err != nil {
+				slog.Warn("failed to close PCM output", "err", err)
+			}
+		}
+		if c.opusOut != nil {
+			if err := c.opusOut.Close(); err != nil {
+				slog.Warn("failed to close Opus output", "err", err)
+			}
+		}
+		if c.cfg.HeardFile != "" {
+			if err := c.heard.save(c.cfg.HeardFile); err != nil {
+				slog.Warn("failed to save last heard list", "err", err)
+			}
+		}
+		if c.db != nil {
+			if err := c.db.Close(); err != nil {
+				slog.Warn("failed to close database", "err", err)
+			}
+		}
+		c.codec2.Close()
+		if c.player != nil {
+			if err := c.player.Close(); err != nil {
+				slog.Warn("failed to close player", "err", err)
+			}
+		}
+		if c.audio != nil {
+			if err := c.audio.Close(); err != nil {
+				slog.Warn("failed to close audio context", "err", err)
+			}
+		}
+	})
 }
 
-// Listen listens for incoming packets
+// Listen listens for incoming packets until cancelled or the source ends
 func (c *Client) listen() {
-	packetSource := gopacket.NewPacketSource(c.handle, c.handle.LinkType())
-	for packet := range packetSource.Packets() {
+	defer c.cancel()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.reapStreams()
+	}()
+
+	switch {
+	case c.reflector != nil:
+		c.readReflector()
+	case c.socket != nil:
+		c.readSocket()
+	default:
+		c.readCapture()
+	}
+
+	// The packet source is exhausted, so finish any streams still open
+	for _, s := range c.streams.drain() {
+		c.finishStream(s, true)
+	}
+}
+
+// readCapture reads packets from the packet source
+func (c *Client) readCapture() {
+	for packet := range c.source.Packets() {
 		select {
 		case <-c.ctx.Done():
 			return
@@ -95,125 +776,597 @@ func (c *Client) listen() {
 			udpLayer := packet.Layer(layers.LayerTypeUDP)
 			if udpLayer != nil {
 				udp, _ := udpLayer.(*layers.UDP)
-				if debug {
-					log.Printf("received packet from %v", packet.NetworkLayer().NetworkFlow().Src())
-				}
-				c.handlePacket(udp.Payload)
+				slog.Debug("received packet", "from", packetOrigin(packet, udp))
+				c.handlePacket(packetOrigin(packet, udp), udp.Payload)
 			}
 		}
 	}
+
+	slog.Info("capture ended")
+}
+
+// packetOrigin formats the source address and port of a captured UDP packet,
+// bracketing IPv6 addresses. Packets without a network layer only have a port.
+func packetOrigin(packet gopacket.Packet, udp *layers.UDP) string {
+	network := packet.NetworkLayer()
+	if network == nil {
+		return fmt.Sprintf("unknown:%d", udp.SrcPort)
+	}
+	return net.JoinHostPort(network.NetworkFlow().Src().String(), strconv.Itoa(int(udp.SrcPort)))
 }
 
 // handlePacket handles incoming packets
-func (c *Client) handlePacket(packet []byte) {
-	if len(packet) < 4 {
+func (c *Client) handlePacket(origin string, packet []byte) {
+	c.metrics.captured.Add(1)
+	if c.paused.Load() || len(packet) < 4 {
 		return
 	}
 
 	magic := string(packet[:4])
 	switch magic {
-	case MagicM17:
-		c.handleM17(packet)
+	case m17.MagicStream:
+		if c.cfg.Dump {
+			dumpM17(os.Stdout, packet)
+			return
+		}
+		c.handleM17(origin, packet)
+	case m17.MagicPacket:
+		if c.cfg.Packets {
+			c.handleM17Packet(origin, packet)
+		}
 	}
 }
 
 // handleM17 handles a M17 packet
-func (c *Client) handleM17(packet []byte) {
-	if len(packet) < 54 {
-		if debug {
-			log.Printf("invalid M17 packet length: %d", len(packet))
+func (c *Client) handleM17(origin string, packet []byte) {
+	c.metrics.packets.Add(1)
+
+	// Check the size, and the CRC over everything before it
+	switch err := m17.CheckStreamFrame(packet); {
+	case errors.Is(err, m17.ErrFrameSize):
+		c.metrics.dropped.Add(1)
+		c.badFrameSize(len(packet))
+		return
+	case err != nil:
+		c.metrics.crcErrors.Add(1)
+		c.streams.crcError(origin, binary.BigEndian.Uint16(packet[4:6]))
+		slog.Debug("M17 packet CRC mismatch", "err", err)
+		return
+	}
+
+	// Hold live frames in the jitter buffer so late ones can be reordered.
+	// Frames replayed from a file arrive in order and too fast to pace.
+	if c.jitter != nil && !c.offline {
+		f, _ := m17.DecodeStreamFrame(packet)
+		if !c.jitter.add(origin, f.StreamID, f.FrameNumber, f.Last, packet) {
+			slog.Debug("ignoring late, duplicate or excess frame", "streamID", hex16(f.StreamID), "frameNumber", f.FrameNumber)
 		}
 		return
 	}
+	c.handleStreamFrame(origin, packet)
+}
 
-	// Parse M17 packet fields
-	streamID := binary.BigEndian.Uint16(packet[4:6])
-	lich := packet[6:34]
-	frameNumber := binary.BigEndian.Uint16(packet[34:36])
-	payload := packet[36:52]
-	// reserved := packet[52:54] // Reserved field, not used
+// badFrameSize reports a stream frame of the wrong size. One with a whole
+// header but a payload that doesn't hold two Codec 2 3200 frames suggests a
+// sender using another codec mode, so each such size is warned about once.
+func (c *Client) badFrameSize(length int) {
+	header := m17.StreamFrameSize - m17.PayloadSize
+	if length <= header {
+		slog.Debug("M17 packet too short to be valid", "length", length, "want", m17.StreamFrameSize)
+		return
+	}
 
-	// Parse LICH fields
-	dst := decodeCallsign(lich[0:6])
-	src := decodeCallsign(lich[6:12])
-	typ := binary.BigEndian.Uint16(lich[12:14])
-	meta := lich[14:28]
+	if _, warned := c.badSizes.LoadOrStore(length, true); warned {
+		slog.Debug("unsupported M17 frame size", "length", length, "want", m17.StreamFrameSize)
+		return
+	}
+	slog.Warn("M17 stream payload size does not match the codec mode, is the sender using a different one?",
+		"payloadBytes", length-header,
+		"want", codec2FramesPerPayload*c.codec2.BytesPerFrame(),
+		"mode", c.codec2.ModeName(),
+	)
+}
 
-	// Parse Type field
-	packetStreamIndicator := typ & 0x0001
-	dataTypeIndicator := (typ >> 1) & 0x0003
-	encryptionType := (typ >> 3) & 0x0003
-	encryptionSubtype := (typ >> 5) & 0x0003
-	channelAccessNumber := (typ >> 7) & 0x000F
+// reservedBits reports an LSF with reserved TYPE bits set, at info level the
+// first time and at debug level after that
+func (c *Client) reservedBits(src string, typ uint16) {
+	level := slog.LevelDebug
+	if c.reserved.CompareAndSwap(false, true) {
+		level = slog.LevelInfo
+	}
+	slog.Log(context.Background(), level, "LSF has reserved TYPE bits set, the sender may be newer than this monitor",
+		"src", src, "type", hex16(typ), "reserved", hex16(typ&m17.TypeReservedMask))
+}
+
+// handleStreamFrame decodes a M17 stream frame that has passed the CRC check
+func (c *Client) handleStreamFrame(origin string, packet []byte) {
+	// Parse M17 packet and LICH fields
+	f, err := m17.DecodeStreamFrame(packet)
+	if err != nil {
+		c.metrics.dropped.Add(1)
+		slog.Debug("invalid stream frame", "err", err)
+		return
+	}
+	streamID, frameNumber, isLast, payload := f.StreamID, f.FrameNumber, f.Last, f.Payload
+	lsf := f.LSF
+
+	// A frame with an empty LSF can only be attributed to a stream whose
+	// earlier frames carried one
+	if lsf.IsEmpty() {
+		cached, ok := c.streams.lastLSF(origin, streamID)
+		if !ok {
+			c.metrics.dropped.Add(1)
+			slog.Debug("ignoring frame without an LSF for an unknown stream", "streamID", hex16(streamID))
+			return
+		}
+		lsf = cached
+	}
+	dst, src, typ, meta := lsf.Dst, lsf.Src, lsf.Type, lsf.Meta
+
+	// Skip destinations we have not been asked to monitor
+	if !c.dstFilter.permits(dst) {
+		c.metrics.filtered.Add(1)
+		slog.Debug("ignoring filtered destination", "streamID", hex16(streamID), "dst", dst)
+		return
+	}
+	if !c.srcFilter.permits(src) {
+		c.metrics.filtered.Add(1)
+		slog.Debug("ignoring filtered source", "streamID", hex16(streamID), "src", src)
+		return
+	}
+
+	// Skip echoes of frames we have already handled
+	if c.dedup != nil && c.dedup.duplicate(frameFingerprint(src, dst, frameNumber, payload), time.Now()) {
+		c.metrics.dropped.Add(1)
+		slog.Debug("ignoring echoed frame", "streamID", hex16(streamID), "frameNumber", frameNumber)
+		return
+	}
 
 	// Log packet fields
-	if debug {
-		log.Printf("Received M17 packet: StreamID=0x%X, FrameNumber=0x%X, DST=%s, SRC=%s, TYPE=0x%X, META=%x", streamID, frameNumber, dst, src, typ, meta)
-		log.Printf("Type field breakdown: PacketStreamIndicator=%d, DataTypeIndicator=%d, EncryptionType=%d, EncryptionSubtype=%d, ChannelAccessNumber=%d",
-			packetStreamIndicator, dataTypeIndicator, encryptionType, encryptionSubtype, channelAccessNumber)
+	if debugEnabled() {
+		slog.Debug("received M17 packet",
+			"streamID", hex16(streamID),
+			"frameNumber", frameNumber,
+			"last", isLast,
+			"dst", dst,
+			"src", src,
+			"type", hex16(typ),
+			"meta", fmt.Sprintf("%x", meta),
+			"stream", lsf.IsStream(),
+			"dataType", lsf.DataType(),
+			"encryptionType", lsf.EncryptionName(),
+			"encryptionSubtype", lsf.EncryptionSubtypeName(),
+			"channelAccessNumber", lsf.ChannelAccessNumber(),
+			"reserved", hex16(lsf.Reserved()),
+		)
+	}
+
+	// Track the stream this packet belongs to
+	name := c.roster.lookup(src)
+	s, replaced, isNew, inOrder := c.streams.update(origin, streamID, src, name, dst, frameNumber, time.Now())
+	if s == nil {
+		c.metrics.dropped.Add(1)
+		slog.Debug("ignoring frame of an ended stream", "streamID", hex16(streamID), "frameNumber", frameNumber)
+		return
+	}
+	if replaced != nil {
+		slog.Debug("StreamID reused by a new stream", "streamID", hex16(streamID), "src", src, "previousSrc", replaced.src)
+		c.finishStream(replaced, true)
+	}
+	if reserved := lsf.Reserved(); reserved != 0 {
+		c.streams.setReserved(s, reserved)
+		c.reservedBits(src, typ)
+	}
+	c.streams.setLSF(s, lsf)
+	if isNew {
+		c.startStream(s)
+	}
+	if !inOrder {
+		c.metrics.dropped.Add(1)
+		slog.Debug("ignoring duplicate or out-of-order frame", "streamID", hex16(streamID), "frameNumber", frameNumber, "lastFrame", s.lastFrame)
+		return
 	}
 
-	// Filter out packets that are not stream mode or are encrypted
-	if packetStreamIndicator == 0 || encryptionType != 0 {
-		if debug {
-			log.Printf("Ignoring packet mode or encrypted packet: TYPE=%d", typ)
+	// The last frame still carries audio, so finish the stream once it is handled
+	if isLast {
+		defer c.endStream(origin, streamID)
+	}
+
+	// Log any metadata carried in the META field
+	if info, ok := parseMeta(lsf); ok {
+		slog.Debug("received metadata", "streamID", hex16(streamID), "src", src, "meta", info)
+		if info.kind == "text" {
+			if text, ok := c.streams.addText(s, meta); ok {
+				slog.Info("received text", "streamID", hex16(streamID), "src", src, "text", text)
+			}
 		}
+		if info.kind == "gnss" && c.streams.setPosition(s, info.position) {
+			slog.Info("received position", "streamID", hex16(streamID), "src", src, "position", info.position)
+			c.emitEvent(streamEvent(eventPosition, s))
+			if c.aprs != nil {
+				c.aprs.report(src, info.position, s.lastSeen)
+			}
+		}
+	}
+
+	// Filter out packets that are not stream mode or cannot be decrypted
+	if !lsf.IsStream() {
+		c.metrics.encrypted.Add(1)
+		slog.Debug("ignoring unsupported packet mode frame", "streamID", hex16(streamID), "type", hex16(typ))
 		return
 	}
+	payload, ok := c.decrypt(s, lsf, frameNumber, payload)
+	if !ok {
+		c.metrics.encrypted.Add(1)
 
-	// Filter out packets that are not voice or voice + data
-	if dataTypeIndicator != 0b10 && dataTypeIndicator != 0b11 {
-		if debug {
-			log.Printf("Ignoring non-voice packet: TYPE=%d", typ)
+		// Say why a new stream will be silent; repeat only at debug level
+		level := slog.LevelDebug
+		if isNew {
+			level = slog.LevelInfo
 		}
+		slog.Log(context.Background(), level, "ignoring encrypted stream",
+			"streamID", hex16(streamID),
+			"src", src,
+			"encryption", lsf.EncryptionName(),
+			"subtype", lsf.EncryptionSubtypeName(),
+		)
 		return
 	}
 
-	// Ensure payload length is correct for Codec 2 at 3200 bps (16 bytes)
-	if len(payload) != 16 {
-		if debug {
-			log.Printf("invalid payload length: %d", len(payload))
+	// Filter out packets that are not voice or voice + data
+	dataType := lsf.DataType()
+	if dataType != m17.DataTypeVoice && dataType != m17.DataTypeVoiceData {
+		c.metrics.dropped.Add(1)
+		slog.Debug("ignoring non-voice packet", "streamID", hex16(streamID), "type", hex16(typ))
+		return
+	}
+
+	// Voice + data streams carry one Codec 2 1600 frame and 8 bytes of data,
+	// which decoded as 3200 would only be noise
+	if dataType == m17.DataTypeVoiceData {
+		c.metrics.dropped.Add(1)
+		if isNew {
+			slog.Warn("not decoding voice + data stream, its Codec 2 1600 voice does not match the codec mode",
+				"streamID", hex16(streamID),
+				"src", src,
+				"voiceBytes", bytesPerCodec2Frame,
+				"want", codec2FramesPerPayload*c.codec2.BytesPerFrame(),
+				"mode", c.codec2.ModeName(),
+			)
 		}
 		return
 	}
 
-	// Decode and play the voice stream using Codec 2
-	audio1, err := c.codec2.Decode(payload[:8])
-	if err != nil {
-		if debug {
-			log.Printf("failed to decode first voice frame: %v", err)
+	// Decode the two Codec 2 frames independently, substituting silence for
+	// one that fails so a single bad frame doesn't lose the whole packet
+	var audio []int16
+	decoded := 0
+	for i := 0; i < codec2FramesPerPayload; i++ {
+		bits := payload[i*bytesPerCodec2Frame : (i+1)*bytesPerCodec2Frame]
+		samples, err := c.codec2.Decode(bits)
+		if err == nil && len(samples) != samplesPerCodec2Frame {
+			err = fmt.Errorf("decoded %d samples, want %d", len(samples), samplesPerCodec2Frame)
+		}
+		if err != nil {
+			c.streams.decodeError(s)
+			slog.Debug("failed to decode voice frame", "streamID", hex16(streamID), "frameNumber", frameNumber, "half", i+1, "err", err)
+			samples = make([]int16, samplesPerCodec2Frame)
+		} else {
+			decoded++
 		}
+		if c.cfg.Levels {
+			logLevels(streamID, frameNumber, i+1, samples)
+		}
+		audio = append(audio, samples...)
+	}
+	if decoded == 0 {
 		return
 	}
+	c.metrics.frames.Add(uint64(decoded))
 
-	audio2, err := c.codec2.Decode(payload[8:])
-	if err != nil {
-		if debug {
-			log.Printf("failed to decode second voice frame: %v", err)
+	// Keep timing intact by filling frames lost before this one with silence
+	if c.cfg.FillGaps && s.gap > 0 {
+		slog.Debug("filling gap", "streamID", hex16(streamID), "frames", s.gap)
+		audio = append(silence(s.gap), audio...)
+	}
+
+	// Remove any DC offset, carrying the filter state through the stream
+	if c.cfg.HighPass {
+		if s.highPass == nil {
+			s.highPass = newHighPass(highPassCutoff, codec2SampleRate)
+		}
+		audio = s.highPass.filter(audio)
+	}
+
+	// Record the audio and hand the frame to every output
+	c.recordAudio(s, audio)
+	frame := &Frame{
+		StreamID:    streamID,
+		Source:      origin,
+		Src:         src,
+		Dst:         dst,
+		Type:        typ,
+		Meta:        meta,
+		FrameNumber: frameNumber,
+		IsLast:      isLast,
+		Audio:       audio,
+	}
+	c.sinks.HandleFrame(frame)
+	c.handler.HandleFrame(frame)
+}
+
+// decrypt returns the plaintext payload of a stream frame, or false if the
+// frame is encrypted and no matching key is configured
+func (c *Client) decrypt(s *stream, lsf m17.LSF, frameNumber uint16, payload []byte) ([]byte, bool) {
+	switch lsf.EncryptionType() {
+	case m17.EncryptionNone:
+		return payload, true
+	case m17.EncryptionScrambler:
+		if c.scrambler == nil || lsf.EncryptionSubtype() != c.scrambler.subtype {
+			return nil, false
 		}
+		if s.scrambler == nil {
+			s.scrambler = newScrambler(c.scrambler)
+		}
+		return s.scrambler.descramble(frameNumber, payload), true
+	case m17.EncryptionAES:
+		if c.aesKey == nil || aesKeySize(lsf.EncryptionSubtype()) != c.aesKey.size {
+			return nil, false
+		}
+		return c.aesKey.decrypt(lsf.Meta, frameNumber, payload), true
+	}
+	return nil, false
+}
+
+// startStream reports a newly seen stream and starts recording it if enabled
+func (c *Client) startStream(s *stream) {
+	_, module := splitDestination(s.dst)
+	args := []any{"streamID", hex16(s.id), "src", s.src, "dst", s.dst, "module", module, "source", s.origin}
+	if s.name != "" {
+		args = append(args, "name", s.name)
+	}
+	slog.Info("new stream started", args...)
+	if c.notify != nil && c.notify.watches(s.src) {
+		c.notifyStream(s)
+	}
+	c.emitEvent(streamEvent(eventStart, s))
+
+	// Separate back to back transmissions so they don't run together
+	if c.cfg.Silence > 0 {
+		c.playAudio(make([]int16, codec2SampleRate*c.cfg.Silence/1000))
+	}
+
+	if c.cfg.RecordDir != "" {
+		path := recordingPath(c.cfg.RecordDir, s.started, s.src, s.dst, s.origin)
+		w, err := newWAVWriter(path, codec2SampleRate)
+		if err != nil {
+			slog.Error("failed to start recording", "streamID", hex16(s.id), "err", err)
+			return
+		}
+		s.recording = w
+	}
+}
+
+// emitEvent publishes a stream event to the JSON stream, web clients and MQTT
+func (c *Client) emitEvent(ev Event) {
+	ev.Seq = c.eventSeq.Add(1)
+	c.events.emit(ev)
+	if c.web != nil {
+		c.web.broadcast(ev)
+	}
+	if c.mqtt != nil {
+		c.mqtt.publish(ev)
+	}
+	if c.tui != nil {
+		c.tui.refresh()
+	}
+}
+
+// endStream marks a stream as complete
+func (c *Client) endStream(origin string, streamID uint16) {
+	if s := c.streams.remove(origin, streamID); s != nil {
+		c.finishStream(s, false)
+	}
+}
+
+// finishStream reports a stream that has ended or timed out
+func (c *Client) finishStream(s *stream, timedOut bool) {
+	slog.Info(s.summary(timedOut), "streamID", hex16(s.id), "src", s.src, "dst", s.dst, "frames", s.packets, "timedOut", timedOut)
+
+	c.heard.add(s)
+	if c.db != nil {
+		c.db.record(s, timedOut)
+	}
+
+	ev := streamEvent(eventEnd, s)
+	ev.TimedOut = timedOut
+	c.emitEvent(ev)
+
+	if s.recording != nil {
+		if err := s.recording.Close(); err != nil {
+			slog.Error("failed to close recording", "streamID", hex16(s.id), "err", err)
+		}
+	}
+}
+
+// reloadRoster re-reads the roster file, if there is one. Streams already
+// in progress keep the name they started with.
+func (c *Client) reloadRoster() {
+	if c.roster == nil {
 		return
 	}
+	if err := c.roster.reload(); err != nil {
+		slog.Error("failed to reload roster, keeping the previous one", "err", err)
+		return
+	}
+	slog.Info("reloaded roster", "path", c.cfg.Roster, "callsigns", c.roster.size())
+}
+
+// logStreams logs a snapshot of the active streams
+func (c *Client) logStreams() {
+	streams := c.streams.snapshot()
+	slog.Info("active streams", "count", len(streams))
+
+	now := time.Now()
+	for _, s := range streams {
+		slog.Info("active stream",
+			"streamID", hex16(s.id),
+			"src", s.src,
+			"dst", s.dst,
+			"age", now.Sub(s.started).Round(time.Millisecond),
+			"idle", now.Sub(s.lastSeen).Round(time.Millisecond),
+			"frames", s.packets,
+		)
+	}
+}
+
+// heartbeat emits a heartbeat event every interval so consumers can tell a
+// quiet network from a dead monitor
+func (c *Client) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case now := <-ticker.C:
+			active := c.streams.count()
+			c.emitEvent(Event{
+				Type:      eventHeartbeat,
+				Timestamp: now,
+				Uptime:    now.Sub(c.started).Seconds(),
+				Active:    &active,
+			})
+		}
+	}
+}
+
+// releaseJitter passes frames from the jitter buffer on for decoding at a
+// steady rate of one frame per stream every frame period
+func (c *Client) releaseJitter() {
+	ticker := time.NewTicker(jitterTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			// Frames buffered before a pause are dropped rather than played
+			if c.paused.Load() {
+				c.jitter.flush()
+				continue
+			}
+			for _, p := range c.jitter.tick() {
+				c.handleStreamFrame(p.origin, p.packet)
+			}
+		}
+	}
+}
 
-	// Combine the two audio frames
-	audio := append(audio1, audio2...)
+// saveHeard saves the last heard list periodically until the client is
+// closed, which saves it a final time
+func (c *Client) saveHeard() {
+	ticker := time.NewTicker(lastHeardSaveInterval)
+	defer ticker.Stop()
 
-	// Play the audio
-	c.playAudio(audio)
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.heard.save(c.cfg.HeardFile); err != nil {
+				slog.Warn("failed to save last heard list", "err", err)
+			}
+		}
+	}
 }
 
-// playAudio plays audio using the Oto player
+// reapStreams periodically removes streams that stopped without an end-of-stream frame
+func (c *Client) reapStreams() {
+	ticker := time.NewTicker(time.Duration(c.cfg.StreamTimeout) * time.Millisecond / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, s := range c.streams.expire(now) {
+				c.finishStream(s, true)
+			}
+		}
+	}
+}
+
+// logLevels logs the RMS and peak level of one Codec 2 frame
+func logLevels(streamID, frameNumber uint16, half int, samples []int16) {
+	rms, peak := levels(samples)
+	slog.Info("audio level",
+		"streamID", hex16(streamID),
+		"frameNumber", frameNumber,
+		"half", half,
+		"rms", fmt.Sprintf("%.1f dBFS", dBFS(rms)),
+		"peak", fmt.Sprintf("%.1f dBFS", dBFS(peak)),
+		"meter", levelBar(rms),
+	)
+}
+
+// recordAudio appends audio to the stream recording, if any
+func (c *Client) recordAudio(s *stream, audio []int16) {
+	if s.recording == nil {
+		return
+	}
+	if err := s.recording.write(audio); err != nil {
+		slog.Error("failed to record audio", "streamID", hex16(s.id), "err", err)
+	}
+}
+
+// playAudio queues audio for the playback goroutine. A full device must not
+// hold up capture, so live audio displaces the oldest queued chunk instead.
+// Audio replayed from a file waits for room, pacing the replay.
 func (c *Client) playAudio(audio []int16) {
-	// Convert int16 audio to byte slice
-	buf := make([]byte, len(audio)*2)
-	for i, sample := range audio {
-		binary.LittleEndian.PutUint16(buf[i*2:], uint16(sample))
+	if c.playback == nil {
+		return
 	}
 
-	// Write audio to Oto player
-	_, err := c.player.Write(buf)
-	if err != nil {
-		if debug {
-			log.Printf("failed to play audio: %v", err)
+	if c.offline {
+		select {
+		case c.playback <- audio:
+		case <-c.ctx.Done():
+		}
+		return
+	}
+
+	for {
+		select {
+		case c.playback <- audio:
+			return
+		default:
+		}
+		select {
+		case <-c.playback:
+			slog.Warn("audio device falling behind, dropping oldest audio")
+		default:
+		}
+	}
+}
+
+// runPlayback writes queued audio to the Oto player until the queue is closed
+func (c *Client) runPlayback() {
+	defer close(c.played)
+
+	// Codec 2 produces 8 kHz audio, so convert it for other output rates
+	rs := newResampler(codec2SampleRate, c.cfg.SampleRate)
+	for audio := range c.playback {
+		audio = rs.resample(audio)
+		audio = applyGain(audio, c.cfg.Gain)
+		audio = duplicateChannels(audio, c.cfg.Channels)
+
+		// Write audio to Oto player
+		if _, err := c.player.Write(pcmBytes(audio)); err != nil {
+			slog.Warn("failed to play audio", "err", err)
 		}
 	}
 }
@@ -0,0 +1,485 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// voiceType is the TYPE of an unencrypted Codec 2 3200 voice stream
+const voiceType = 0x0005
+
+// makeFrame builds a 54-byte stream frame with a valid CRC
+func makeFrame(t testing.TB, id uint16, src, dst string, typ uint16, meta []byte, fn uint16, payload []byte) []byte {
+	t.Helper()
+	p := make([]byte, m17.StreamFrameSize)
+	copy(p, m17.MagicStream)
+	binary.BigEndian.PutUint16(p[4:], id)
+	if dst != "" || src != "" {
+		d, err := m17.EncodeCallsign(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := m17.EncodeCallsign(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(p[6:], d)
+		copy(p[12:], s)
+	}
+	binary.BigEndian.PutUint16(p[18:], typ)
+	copy(p[20:34], meta)
+	binary.BigEndian.PutUint16(p[34:], fn)
+	copy(p[36:52], payload)
+	binary.BigEndian.PutUint16(p[52:], m17.CRC(p[:52]))
+	return p
+}
+
+// newTestClient creates a client without audio output, collecting the frames
+// it decodes
+func newTestClient(t *testing.T, cfg Config) (*Client, *[]*Frame) {
+	t.Helper()
+	cfg.NoSound = true
+	if cfg.StreamTimeout == 0 {
+		cfg.StreamTimeout = DefaultStreamTimeout
+	}
+	c, err := newClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	var frames []*Frame
+	c.SetFrameHandler(FrameHandlerFunc(func(f *Frame) { frames = append(frames, f) }))
+	return c, &frames
+}
+
+// fakeSource is a packet source fed by the test, counting its Close calls
+type fakeSource struct {
+	packets chan gopacket.Packet
+	closed  int
+}
+
+func (f *fakeSource) Packets() chan gopacket.Packet { return f.packets }
+func (f *fakeSource) Close()                        { f.closed++ }
+
+func TestCloseTwice(t *testing.T) {
+	tests := []struct {
+		name     string
+		playback bool
+	}{
+		{"without playback", false},
+		{"with playback", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t, Config{})
+			src := &fakeSource{packets: make(chan gopacket.Packet)}
+			c.source = src
+			if tt.playback {
+				// Stand in for the audio device, draining the queue until it closes
+				c.playback, c.played = make(chan []int16, playbackQueue), make(chan struct{})
+				go func() {
+					defer close(c.played)
+					for range c.playback {
+					}
+				}()
+			}
+
+			c.Close()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				c.Close()
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("second Close blocked")
+			}
+			if src.closed != 1 {
+				t.Errorf("source closed %d times, want once", src.closed)
+			}
+		})
+	}
+}
+
+func TestNewClientInterface(t *testing.T) {
+	tests := []struct {
+		name  string
+		iface string
+		want  string
+	}{
+		{"empty", "", "no capture interface specified"},
+		{"bogus", "m17-no-such-iface0", `failed to open device "m17-no-such-iface0"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(Config{Interface: tt.iface, Ports: "17000", Snaplen: DefaultSnaplen, NoSound: true, StreamTimeout: DefaultStreamTimeout})
+			if err == nil {
+				c.Close()
+				t.Fatal("NewClient succeeded, want an error")
+			}
+			if msg := err.Error(); !strings.Contains(msg, tt.want) || !strings.Contains(msg, "available:") {
+				t.Errorf("NewClient error %q, want it to contain %q and the available interfaces", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortFilter(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"17010", "udp port 17010", false},
+		{"17010,17011", "udp port 17010 or udp port 17011", false},
+		{" 17010 , 17020-17029 ", "udp port 17010 or udp portrange 17020-17029", false},
+		{"17010,,17011,", "udp port 17010 or udp port 17011", false},
+		{"1-65535", "udp portrange 1-65535", false},
+		{"", "", true},
+		{",", "", true},
+		{"0", "", true},
+		{"65536", "", true},
+		{"abc", "", true},
+		{"17029-17020", "", true},
+		{"17020-", "", true},
+	}
+	for _, tt := range tests {
+		got, err := portFilter(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("portFilter(%q) = %q, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("portFilter(%q) = %q, %v, want %q", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+// captureEvents switches the client's events on, returning a function that
+// reads back the events emitted so far
+func captureEvents(t *testing.T, c *Client) func() []Event {
+	t.Helper()
+	var buf bytes.Buffer
+	c.events = newEventEmitter(true, &buf)
+	return func() []Event {
+		var events []Event
+		dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+		for dec.More() {
+			var ev Event
+			if err := dec.Decode(&ev); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, ev)
+		}
+		return events
+	}
+}
+
+func TestFillGaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		fillGaps bool
+		frames   []uint16
+		silence  int
+	}{
+		{"two frames missing", true, []uint16{0, 3}, 2 * samplesPerFrame},
+		{"no frames missing", true, []uint16{0, 1}, 0},
+		{"not filling", false, []uint16{0, 3}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{FillGaps: tt.fillGaps})
+			for _, fn := range tt.frames {
+				c.handleM17("", makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, fn, make([]byte, m17.PayloadSize)))
+			}
+			if len(*frames) != len(tt.frames) {
+				t.Fatalf("decoded %d frames, want %d", len(*frames), len(tt.frames))
+			}
+			audio := (*frames)[1].Audio
+			if len(audio) != tt.silence+samplesPerFrame {
+				t.Fatalf("frame after the gap has %d samples, want %d", len(audio), tt.silence+samplesPerFrame)
+			}
+			for i, v := range audio[:tt.silence] {
+				if v != 0 {
+					t.Fatalf("sample %d of the filled gap is %d, want silence", i, v)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleM17CRC(t *testing.T) {
+	good := makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize))
+	corrupt := func(i int) []byte {
+		p := append([]byte(nil), good...)
+		p[i] ^= 0x80
+		return p
+	}
+
+	tests := []struct {
+		name      string
+		packet    []byte
+		frames    int
+		crcErrors uint64
+	}{
+		{"good", good, 1, 0},
+		{"corrupt source", corrupt(12), 0, 1},
+		{"corrupt payload", corrupt(36), 0, 1},
+		{"corrupt CRC", corrupt(52), 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{})
+			c.handleM17("", tt.packet)
+			if len(*frames) != tt.frames {
+				t.Errorf("decoded %d frames, want %d", len(*frames), tt.frames)
+			}
+			if got := c.metrics.crcErrors.Load(); got != tt.crcErrors {
+				t.Errorf("counted %d CRC errors, want %d", got, tt.crcErrors)
+			}
+		})
+	}
+}
+
+func TestBadFrameSize(t *testing.T) {
+	frame := makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize))
+	header := m17.StreamFrameSize - m17.PayloadSize
+
+	tests := []struct {
+		name   string
+		packet []byte
+		frames int
+		warned bool // reported as a payload size mismatch rather than too short
+	}{
+		{"truncated", frame[:20], 0, false},
+		{"header only", frame[:header], 0, false},
+		{"15-byte payload", frame[:header+15], 0, true},
+		{"valid", frame, 1, false},
+		{"24-byte payload", append(append([]byte(nil), frame...), make([]byte, 8)...), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{})
+			c.handleM17("", tt.packet)
+			if len(*frames) != tt.frames {
+				t.Errorf("decoded %d frames, want %d", len(*frames), tt.frames)
+			}
+			if _, warned := c.badSizes.Load(len(tt.packet)); warned != tt.warned {
+				t.Errorf("size %d warned %t, want %t", len(tt.packet), warned, tt.warned)
+			}
+		})
+	}
+}
+
+// udpPacket builds an Ethernet frame carrying payload in a UDP datagram from
+// src:port
+func udpPacket(t testing.TB, src net.IP, port layers.UDPPort, payload []byte) gopacket.Packet {
+	t.Helper()
+	eth := &layers.Ethernet{SrcMAC: make(net.HardwareAddr, 6), DstMAC: make(net.HardwareAddr, 6)}
+	udp := &layers.UDP{SrcPort: port, DstPort: 17000}
+	var ip gopacket.SerializableLayer
+	if v4 := src.To4(); v4 != nil {
+		l := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: v4, DstIP: v4}
+		eth.EthernetType = layers.EthernetTypeIPv4
+		udp.SetNetworkLayerForChecksum(l)
+		ip = l
+	} else {
+		l := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: src, DstIP: src}
+		eth.EthernetType = layers.EthernetTypeIPv6
+		udp.SetNetworkLayerForChecksum(l)
+		ip = l
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+}
+
+// bareUDPPacket builds a UDP datagram with no link or network layer around it
+func bareUDPPacket(t testing.TB, port layers.UDPPort, payload []byte) gopacket.Packet {
+	t.Helper()
+	buf := gopacket.NewSerializeBuffer()
+	udp := &layers.UDP{SrcPort: port, DstPort: 17000}
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeUDP, gopacket.Default)
+}
+
+func TestPacketOrigin(t *testing.T) {
+	frame := makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize))
+	tests := []struct {
+		name   string
+		packet gopacket.Packet
+		want   string
+	}{
+		{"IPv4", udpPacket(t, net.IPv4(192, 0, 2, 1), 17000, frame), "192.0.2.1:17000"},
+		{"IPv6", udpPacket(t, net.ParseIP("2001:db8::1"), 17001, frame), "[2001:db8::1]:17001"},
+		{"no network layer", bareUDPPacket(t, 17002, frame), "unknown:17002"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			udp, ok := tt.packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+			if !ok {
+				t.Fatal("no UDP layer")
+			}
+			if got := packetOrigin(tt.packet, udp); got != tt.want {
+				t.Errorf("packetOrigin = %q, want %q", got, tt.want)
+			}
+
+			c, frames := newTestClient(t, Config{})
+			c.handlePacket("", udp.Payload)
+			if len(*frames) != 1 {
+				t.Errorf("decoded %d frames, want 1", len(*frames))
+			}
+		})
+	}
+}
+
+// failingDecoder fails to decode Codec 2 frames starting with fail
+type failingDecoder struct {
+	voiceDecoder
+	fail byte
+}
+
+func (d failingDecoder) Decode(bits []byte) ([]int16, error) {
+	if bits[0] == d.fail {
+		return nil, errors.New("simulated decode failure")
+	}
+	return d.voiceDecoder.Decode(bits)
+}
+
+func TestHalfDecodeFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		first, second byte
+		played        bool
+	}{
+		{"both decode", 0, 0, true},
+		{"first fails", 0xFF, 0, true},
+		{"second fails", 0, 0xFF, true},
+		{"both fail", 0xFF, 0xFF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{})
+			c.codec2 = failingDecoder{c.codec2, 0xFF}
+			payload := make([]byte, m17.PayloadSize)
+			payload[0], payload[bytesPerCodec2Frame] = tt.first, tt.second
+			c.handleM17("", makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 0, payload))
+
+			if !tt.played {
+				if len(*frames) != 0 {
+					t.Errorf("played %d frames, want none", len(*frames))
+				}
+				return
+			}
+			if len(*frames) != 1 {
+				t.Fatalf("played %d frames, want 1", len(*frames))
+			}
+			audio := (*frames)[0].Audio
+			if len(audio) != samplesPerFrame {
+				t.Fatalf("frame has %d samples, want %d", len(audio), samplesPerFrame)
+			}
+			for half, bits := range []byte{tt.first, tt.second} {
+				if bits != 0xFF {
+					continue
+				}
+				for i, v := range audio[half*samplesPerCodec2Frame : (half+1)*samplesPerCodec2Frame] {
+					if v != 0 {
+						t.Fatalf("sample %d of failed half %d is %d, want silence", i, half+1, v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandlePacketLengths(t *testing.T) {
+	frame := makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize))
+	packet := append([]byte(m17.MagicPacket), make([]byte, m17.LSFSize+3)...)
+
+	tests := []struct {
+		name    string
+		packet  []byte
+		frames  int
+		dropped uint64
+	}{
+		{"empty", nil, 0, 0},
+		{"short magic", frame[:3], 0, 0},
+		{"magic only", frame[:4], 0, 1},
+		{"header only", frame[:m17.StreamFrameSize-m17.PayloadSize], 0, 1},
+		{"one byte short", frame[:m17.StreamFrameSize-1], 0, 1},
+		{"stream frame", frame, 1, 0},
+		{"one byte long", append(append([]byte(nil), frame...), 0), 0, 1},
+		{"packet magic only", packet[:4], 0, 1},
+		{"packet header short", packet[:m17.PacketHeaderSize-1], 0, 1},
+		{"packet header only", packet[:m17.PacketHeaderSize], 0, 0},
+		{"packet header and one byte", packet[:m17.PacketHeaderSize+1], 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{Packets: true})
+			c.handlePacket("", tt.packet)
+			if len(*frames) != tt.frames {
+				t.Errorf("decoded %d frames, want %d", len(*frames), tt.frames)
+			}
+			if got := c.metrics.dropped.Load(); got != tt.dropped {
+				t.Errorf("dropped %d packets, want %d", got, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestListenFakeSource(t *testing.T) {
+	c, frames := newTestClient(t, Config{})
+	src := &fakeSource{packets: make(chan gopacket.Packet, 1)}
+	c.source = src
+
+	src.packets <- udpPacket(t, net.IPv4(192, 0, 2, 1), 17000, makeFrame(t, 0x1234, "KC1AWV", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize)))
+	close(src.packets)
+	c.listen()
+
+	if len(*frames) != 1 {
+		t.Fatalf("decoded %d frames, want 1", len(*frames))
+	}
+	f := (*frames)[0]
+	if f.Src != "KC1AWV" || f.Dst != "M17-XXX A" || f.StreamID != 0x1234 || f.Source != "192.0.2.1:17000" {
+		t.Errorf("got frame src %q dst %q streamID %#04x source %q, want KC1AWV, M17-XXX A, 0x1234, 192.0.2.1:17000",
+			f.Src, f.Dst, f.StreamID, f.Source)
+	}
+}
@@ -21,10 +21,21 @@ package codec2
 #cgo LDFLAGS: -lcodec2
 #include <codec2/codec2.h>
 #include <stdlib.h>
+
+// Releases since 0.9 define CODEC2_VERSION in version.h, which codec2.h
+// includes; older ones have no version at all
+static const char *codec2_version(void) {
+#ifdef CODEC2_VERSION
+	return CODEC2_VERSION;
+#else
+	return "";
+#endif
+}
 */
 import "C"
 import (
 	"errors"
+	"fmt"
 	"unsafe"
 )
 
@@ -37,32 +48,102 @@ type Codec2 struct {
 // Codec2 modes
 const (
 	MODE_3200 = C.CODEC2_MODE_3200
+	MODE_2400 = C.CODEC2_MODE_2400
+	MODE_1600 = C.CODEC2_MODE_1600
+	MODE_1400 = C.CODEC2_MODE_1400
+	MODE_1300 = C.CODEC2_MODE_1300
+	MODE_1200 = C.CODEC2_MODE_1200
+	MODE_700C = C.CODEC2_MODE_700C
 )
 
+// modes lists the supported Codec2 modes
+var modes = map[int]string{
+	MODE_3200: "3200",
+	MODE_2400: "2400",
+	MODE_1600: "1600",
+	MODE_1400: "1400",
+	MODE_1300: "1300",
+	MODE_1200: "1200",
+	MODE_700C: "700C",
+}
+
+// ErrClosed is returned when encoding or decoding with a closed codec
+var ErrClosed = errors.New("codec2 is closed")
+
+// Version returns the libcodec2 version the package was built against, e.g.
+// "1.2.0", or "" if the headers are too old to say. libcodec2 has no call
+// reporting the version of the library actually loaded.
+func Version() string {
+	return C.GoString(C.codec2_version())
+}
+
 // New creates a new Codec2 codec
 func New(mode int) (*Codec2, error) {
+	if _, ok := modes[mode]; !ok {
+		return nil, fmt.Errorf("unsupported codec2 mode: %d", mode)
+	}
+
 	handle := C.codec2_create(C.int(mode))
 	if handle == nil {
-		return nil, errors.New("failed to create codec2")
+		return nil, fmt.Errorf("codec2_create failed for mode %s; is libcodec2 installed with this mode enabled?", modes[mode])
 	}
 	return &Codec2{handle: handle, mode: mode}, nil
 }
 
 // Close closes the Codec2 codec
 func (c *Codec2) Close() {
+	if c.handle == nil {
+		return
+	}
 	C.codec2_destroy(c.handle)
+	c.handle = nil
+}
+
+// ModeName returns the name of the codec mode, e.g. "3200"
+func (c *Codec2) ModeName() string {
+	return modes[c.mode]
+}
+
+// SamplesPerFrame returns the number of audio samples in a frame
+func (c *Codec2) SamplesPerFrame() int {
+	return int(C.codec2_samples_per_frame(c.handle))
+}
+
+// BitsPerFrame returns the number of encoded bits in a frame
+func (c *Codec2) BitsPerFrame() int {
+	return int(C.codec2_bits_per_frame(c.handle))
+}
+
+// BytesPerFrame returns the number of bytes needed to hold an encoded frame
+func (c *Codec2) BytesPerFrame() int {
+	return (c.BitsPerFrame() + 7) / 8
 }
 
 // Encode encodes audio samples to bits
-func (c *Codec2) Decode(bits []byte) ([]int16, error) {
-	nsam := C.codec2_samples_per_frame(c.handle)
-	nbit := C.codec2_bits_per_frame(c.handle)
+func (c *Codec2) Encode(samples []int16) ([]byte, error) {
+	if c.handle == nil {
+		return nil, ErrClosed
+	}
+	if len(samples) != c.SamplesPerFrame() {
+		return nil, errors.New("invalid sample count")
+	}
+
+	bits := make([]byte, c.BytesPerFrame())
+	C.codec2_encode(c.handle, (*C.uchar)(unsafe.Pointer(&bits[0])), (*C.short)(unsafe.Pointer(&samples[0])))
+
+	return bits, nil
+}
 
-	if len(bits) != int(nbit/8) {
+// Decode decodes bits to audio samples
+func (c *Codec2) Decode(bits []byte) ([]int16, error) {
+	if c.handle == nil {
+		return nil, ErrClosed
+	}
+	if len(bits) != c.BytesPerFrame() {
 		return nil, errors.New("invalid bit length")
 	}
 
-	audio := make([]int16, nsam)
+	audio := make([]int16, c.SamplesPerFrame())
 	C.codec2_decode(c.handle, (*C.short)(unsafe.Pointer(&audio[0])), (*C.uchar)(unsafe.Pointer(&bits[0])))
 
 	return audio, nil
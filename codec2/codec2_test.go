@@ -0,0 +1,151 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package codec2
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// sine returns n samples of a 1 kHz tone at 8 kHz
+func sine(n int) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(8000 * math.Sin(2*math.Pi*1000*float64(i)/8000))
+	}
+	return samples
+}
+
+func TestEncodeDecode(t *testing.T) {
+	c, err := New(MODE_3200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tests := []struct {
+		name    string
+		samples []int16
+		wantErr bool
+	}{
+		{"one frame", sine(c.SamplesPerFrame()), false},
+		{"silence", make([]int16, c.SamplesPerFrame()), false},
+		{"short", sine(c.SamplesPerFrame() - 1), true},
+		{"long", sine(c.SamplesPerFrame() + 1), true},
+		{"empty", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bits, err := c.Encode(tt.samples)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Encode of %d samples succeeded, want an error", len(tt.samples))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bits) != c.BitsPerFrame()/8 {
+				t.Errorf("Encode returned %d bytes, want %d", len(bits), c.BitsPerFrame()/8)
+			}
+
+			audio, err := c.Decode(bits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(audio) != c.SamplesPerFrame() {
+				t.Errorf("Decode returned %d samples, want %d", len(audio), c.SamplesPerFrame())
+			}
+		})
+	}
+}
+
+func TestClosed(t *testing.T) {
+	c, err := New(MODE_3200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c.Close()
+
+	if _, err := c.Encode(make([]int16, 160)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Encode after Close: %v, want ErrClosed", err)
+	}
+	if _, err := c.Decode(make([]byte, 8)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Decode after Close: %v, want ErrClosed", err)
+	}
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		mode    int
+		name    string
+		samples int
+		bits    int
+	}{
+		{MODE_3200, "3200", 160, 64},
+		{MODE_2400, "2400", 160, 48},
+		{MODE_1600, "1600", 320, 64},
+		{MODE_1400, "1400", 320, 56},
+		{MODE_1300, "1300", 320, 52},
+		{MODE_1200, "1200", 320, 48},
+		{MODE_700C, "700C", 320, 28},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if c.ModeName() != tt.name || c.SamplesPerFrame() != tt.samples || c.BitsPerFrame() != tt.bits {
+				t.Errorf("mode %s has %d samples of %d bits, want %s with %d samples of %d bits",
+					c.ModeName(), c.SamplesPerFrame(), c.BitsPerFrame(), tt.name, tt.samples, tt.bits)
+			}
+			if want := (tt.bits + 7) / 8; c.BytesPerFrame() != want {
+				t.Errorf("BytesPerFrame = %d, want %d", c.BytesPerFrame(), want)
+			}
+		})
+	}
+}
+
+func TestInvalidMode(t *testing.T) {
+	tests := []struct {
+		name string
+		mode int
+	}{
+		{"negative", -1},
+		{"unknown", 99},
+		{"between modes", 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.mode)
+			if err == nil {
+				c.Close()
+				t.Fatalf("New(%d) succeeded, want an error", tt.mode)
+			}
+			if c != nil {
+				t.Errorf("New(%d) returned a codec with its error", tt.mode)
+			}
+		})
+	}
+}
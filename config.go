@@ -0,0 +1,177 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config holds the client settings
+type Config struct {
+	Interface  string `json:"interface"`  // network interface to capture on
+	Ports      string `json:"ports"`      // UDP ports carrying M17 traffic, e.g. "17010,17020-17029"
+	Retry      int    `json:"retry"`      // times to retry opening the interface before giving up
+	Snaplen    int    `json:"snaplen"`    // capture snapshot length in bytes
+	Promisc    bool   `json:"promisc"`    // capture in promiscuous mode
+	BPF        string `json:"bpf"`        // extra BPF expression ANDed with the port filter
+	BPFReplace bool   `json:"bpfReplace"` // use the BPF expression instead of the port filter
+	Listen     string `json:"listen"`     // UDP address to receive datagrams on instead of capturing
+
+	JSON          bool   `json:"json"`          // emit stream events as JSON lines
+	Heartbeat     int    `json:"heartbeat"`     // seconds between heartbeat events, 0 to disable
+	Stats         int    `json:"stats"`         // seconds between throughput log lines, 0 to disable
+	TUI           bool   `json:"tui"`           // show a full-screen terminal view instead of logging
+	Dump          bool   `json:"dump"`          // dump parsed M17 packets instead of decoding audio
+	Packets       bool   `json:"packets"`       // decode packet mode data such as SMS
+	RecordDir     string `json:"recordDir"`     // directory for per-stream WAV recordings
+	DBPath        string `json:"db"`            // SQLite database logging every finished transmission
+	HeardFile     string `json:"heardFile"`     // JSON file keeping the last heard list across restarts
+	Roster        string `json:"roster"`        // CSV file of callsign,name rows for naming operators
+	FillGaps      bool   `json:"fillGaps"`      // insert silence for frames missing from a stream
+	StreamTimeout int    `json:"streamTimeout"` // ms without frames before a stream is considered ended
+	Jitter        int    `json:"jitter"`        // frames buffered per stream to reorder late arrivals, 0 to disable
+	Dedup         int    `json:"dedup"`         // ms to remember frames for skipping echoes, 0 to disable
+	DstAllow      string `json:"dst"`           // comma-separated destinations to accept, empty for all
+	DstDeny       string `json:"dstDeny"`       // comma-separated destinations to reject
+	SrcAllow      string `json:"srcAllow"`      // comma-separated sources to accept, empty for all
+	SrcDeny       string `json:"srcDeny"`       // comma-separated sources to reject; deny wins over allow
+	NotifySrc     string `json:"notifySrc"`     // comma-separated sources to beep and notify on when they start transmitting
+
+	PCMOut      string `json:"pcmOut"`      // file, named pipe or "-" for raw 8 kHz PCM output
+	PCMEndian   string `json:"pcmEndian"`   // byte order of raw PCM output, little or big; playback stays little-endian
+	OpusOut     string `json:"opusOut"`     // file, named pipe or "-" for length-prefixed Opus packets
+	OpusBitrate int    `json:"opusBitrate"` // Opus bitrate in bits per second
+
+	AESKey      string `json:"aesKey"`      // hex AES key for decrypting encrypted streams
+	ScrambleKey string `json:"scrambleKey"` // hex 8, 16 or 24-bit scrambler seed
+
+	MetricsAddr string `json:"metrics"`   // address for the Prometheus metrics endpoint
+	WebAddr     string `json:"web"`       // address for the live web page
+	APIAddr     string `json:"api"`       // address for the REST API
+	StreamAddr  string `json:"stream"`    // address for the HTTP audio stream
+	MQTTBroker  string `json:"mqtt"`      // MQTT broker host:port for stream events
+	MQTTTopic   string `json:"mqttTopic"` // MQTT topic for stream events
+
+	APRSServer   string `json:"aprsServer"`   // APRS-IS server host:port for forwarding positions
+	APRSCall     string `json:"aprsCall"`     // our callsign for logging in to APRS-IS
+	APRSPass     string `json:"aprsPass"`     // APRS-IS passcode for APRSCall
+	APRSInterval int    `json:"aprsInterval"` // minimum seconds between beacons for one station
+
+	Connect     string `json:"connect"`     // reflector address to connect to instead of capturing
+	Module      string `json:"module"`      // reflector module to link to
+	Callsign    string `json:"callsign"`    // our callsign when connecting to a reflector
+	PingTimeout int    `json:"pingTimeout"` // seconds without packets from the reflector before relinking
+
+	NoSound     bool    `json:"nosound"`     // run headless without opening an audio device
+	SampleRate  int     `json:"sampleRate"`  // audio output sample rate in Hz
+	Channels    int     `json:"channels"`    // audio output channels: 1 for mono, 2 to play the same audio on both
+	AudioBuffer int     `json:"audioBuffer"` // audio output buffer size in bytes
+	AudioDevice string  `json:"audioDevice"` // PulseAudio or PipeWire sink name to play through
+	Gain        float64 `json:"gain"`        // playback volume multiplier
+	HighPass    bool    `json:"hpf"`         // filter DC offset and low-frequency rumble from decoded audio
+	Silence     int     `json:"silence"`     // ms of silence played before each transmission
+	Levels      bool    `json:"levels"`      // log the level of each decoded Codec 2 frame
+}
+
+// loadConfig reads a JSON config file over cfg. Settings missing from the
+// file keep their current values.
+func loadConfig(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config: %w", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+// setFlags returns the values of flags given explicitly on the command line
+func setFlags(fs *flag.FlagSet) map[string]string {
+	set := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+	return set
+}
+
+// envPrefix prefixes the environment variables that can stand in for flags,
+// e.g. M17_IFACE for -iface or M17_FILL_GAPS for -fill-gaps
+const envPrefix = "M17_"
+
+// envName returns the environment variable for a flag
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// envFlags returns values from the environment for flags not given
+// explicitly on the command line
+func envFlags(fs *flag.FlagSet, set map[string]string, lookup func(string) (string, bool)) map[string]string {
+	env := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := set[f.Name]; ok {
+			return
+		}
+		if value, ok := lookup(envName(f.Name)); ok {
+			env[f.Name] = value
+		}
+	})
+	return env
+}
+
+// applyFlags re-applies explicitly set flags so they take precedence over
+// values loaded from elsewhere
+func applyFlags(fs *flag.FlagSet, set map[string]string) error {
+	for name, value := range set {
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for -%s: %w", value, name, err)
+		}
+	}
+	return nil
+}
+
+// resolveConfig settles the settings bound to fs, taking them in order of
+// precedence from flags given on the command line, M17_* environment
+// variables, the config file named by the -config flag into cfg, and the
+// built-in defaults
+func resolveConfig(fs *flag.FlagSet, cfg *Config, lookup func(string) (string, bool)) error {
+	overrides := setFlags(fs)
+	for name, value := range envFlags(fs, overrides, lookup) {
+		overrides[name] = value
+	}
+	if err := applyFlags(fs, overrides); err != nil {
+		return err
+	}
+
+	path := fs.Lookup("config")
+	if path == nil || path.Value.String() == "" {
+		return nil
+	}
+	if err := loadConfig(path.Value.String(), cfg); err != nil {
+		return err
+	}
+	return applyFlags(fs, overrides)
+}
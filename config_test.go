@@ -0,0 +1,189 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFlags binds a few flags to cfg as main does, with their defaults
+func testFlags(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", "", "")
+	fs.StringVar(&cfg.Interface, "iface", "lo", "")
+	fs.StringVar(&cfg.Ports, "port", "17010", "")
+	fs.IntVar(&cfg.SampleRate, "samplerate", 8000, "")
+	fs.BoolVar(&cfg.FillGaps, "fill-gaps", false, "")
+	return fs
+}
+
+// noEnv is an environment lookup finding nothing
+func noEnv(string) (string, bool) { return "", false }
+
+func TestResolveConfigFile(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		file string
+		want Config
+	}{
+		{"defaults", nil, "", Config{Interface: "lo", Ports: "17010", SampleRate: 8000}},
+		{"file over defaults", nil, `{"interface": "eth0", "fillGaps": true}`,
+			Config{Interface: "eth0", Ports: "17010", SampleRate: 8000, FillGaps: true}},
+		{"flags over file", []string{"-iface", "wlan0", "-samplerate", "48000"}, `{"interface": "eth0", "ports": "17000", "sampleRate": 16000}`,
+			Config{Interface: "wlan0", Ports: "17000", SampleRate: 48000}},
+		{"flag set to its default over file", []string{"-iface", "lo"}, `{"interface": "eth0"}`,
+			Config{Interface: "lo", Ports: "17010", SampleRate: 8000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			fs := testFlags(&cfg)
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "config.json")
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"-config", path}, args...)
+			}
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := resolveConfig(fs, &cfg, noEnv); err != nil {
+				t.Fatal(err)
+			}
+			if cfg != tt.want {
+				t.Errorf("resolved %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveConfigEnv(t *testing.T) {
+	file := `{"interface": "eth0", "ports": "17000", "sampleRate": 16000}`
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want Config
+	}{
+		{"env over defaults", nil, map[string]string{"M17_IFACE": "eth1", "M17_FILL_GAPS": "true"},
+			Config{Interface: "eth1", Ports: "17000", SampleRate: 16000, FillGaps: true}},
+		{"env over file", nil, map[string]string{"M17_PORT": "17020-17029", "M17_SAMPLERATE": "48000"},
+			Config{Interface: "eth0", Ports: "17020-17029", SampleRate: 48000}},
+		{"flags over env", []string{"-iface", "wlan0"}, map[string]string{"M17_IFACE": "eth1"},
+			Config{Interface: "wlan0", Ports: "17000", SampleRate: 16000}},
+		{"unrelated variables", nil, map[string]string{"IFACE": "eth1", "M17_NOSUCH": "x"},
+			Config{Interface: "eth0", Ports: "17000", SampleRate: 16000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var cfg Config
+			fs := testFlags(&cfg)
+			if err := fs.Parse(append([]string{"-config", path}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+
+			lookup := func(name string) (string, bool) {
+				v, ok := tt.env[name]
+				return v, ok
+			}
+			if err := resolveConfig(fs, &cfg, lookup); err != nil {
+				t.Fatal(err)
+			}
+			if cfg != tt.want {
+				t.Errorf("resolved %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveConfigEnvInvalid(t *testing.T) {
+	var cfg Config
+	fs := testFlags(&cfg)
+	lookup := func(name string) (string, bool) { return "fast", name == "M17_SAMPLERATE" }
+	if err := resolveConfig(fs, &cfg, lookup); err == nil {
+		t.Error("resolveConfig with M17_SAMPLERATE=fast succeeded, want an error")
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"iface":          "M17_IFACE",
+		"fill-gaps":      "M17_FILL_GAPS",
+		"stream-timeout": "M17_STREAM_TIMEOUT",
+	}
+	for flag, want := range tests {
+		if got := envName(flag); got != want {
+			t.Errorf("envName(%q) = %q, want %q", flag, got, want)
+		}
+	}
+}
+
+func TestResolveConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"unknown setting", `{"interfaces": "eth0"}`},
+		{"wrong type", `{"sampleRate": "fast"}`},
+		{"malformed", `{"interface": `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var cfg Config
+			fs := testFlags(&cfg)
+			if err := fs.Parse([]string{"-config", path}); err != nil {
+				t.Fatal(err)
+			}
+			if err := resolveConfig(fs, &cfg, noEnv); err == nil {
+				t.Error("resolveConfig succeeded, want an error")
+			}
+		})
+	}
+
+	var cfg Config
+	fs := testFlags(&cfg)
+	if err := fs.Parse([]string{"-config", filepath.Join(dir, "missing.json")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveConfig(fs, &cfg, noEnv); err == nil {
+		t.Error("resolveConfig with a missing file succeeded, want an error")
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	var cfg Config
+	if err := loadConfig("config.example.json", &cfg); err != nil {
+		t.Fatal(err)
+	}
+}
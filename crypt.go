@@ -0,0 +1,168 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// aesNonceSize is the length of the nonce carried in META
+const aesNonceSize = 14
+
+// aesKey is a configured AES key
+type aesKey struct {
+	block cipher.Block
+	size  int // key length in bytes
+}
+
+// newAESKey parses a hex encoded AES-128, AES-192 or AES-256 key
+func newAESKey(hexKey string) (*aesKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode AES key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	return &aesKey{block: block, size: len(key)}, nil
+}
+
+// aesKeySize returns the key length in bytes signalled by an AES encryption
+// subtype, or 0 if the subtype is reserved
+func aesKeySize(subtype uint16) int {
+	switch subtype {
+	case 0b00:
+		return 16
+	case 0b01:
+		return 24
+	case 0b10:
+		return 32
+	}
+	return 0
+}
+
+// decrypt decrypts a stream payload in CTR mode. The counter block is the
+// 14-byte nonce from META followed by the 15-bit frame number.
+func (k *aesKey) decrypt(meta []byte, frameNumber uint16, payload []byte) []byte {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, meta[:aesNonceSize])
+	binary.BigEndian.PutUint16(iv[aesNonceSize:], frameNumber&m17.FrameNumberMask)
+
+	plain := make([]byte, len(payload))
+	cipher.NewCTR(k.block, iv).XORKeyStream(plain, payload)
+	return plain
+}
+
+// scramblerTaps holds the LFSR feedback taps for each scrambler subtype:
+// x^8+x^6+x^5+x^4+1, x^16+x^15+x^13+x^4+1 and x^24+x^23+x^22+x^17+1
+var scramblerTaps = [3][4]uint{
+	{7, 5, 4, 3},
+	{15, 14, 12, 3},
+	{23, 22, 21, 16},
+}
+
+// scramblerKey is a configured scrambler seed
+type scramblerKey struct {
+	seed    uint32
+	subtype uint16 // 0, 1 or 2 for an 8, 16 or 24-bit seed
+}
+
+// newScramblerKey parses a hex encoded 8, 16 or 24-bit scrambler seed. The
+// width is taken from the number of hex digits.
+func newScramblerKey(hexKey string) (*scramblerKey, error) {
+	hexKey = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(hexKey)), "0x")
+	if len(hexKey) != 2 && len(hexKey) != 4 && len(hexKey) != 6 {
+		return nil, fmt.Errorf("scrambler key must be 2, 4 or 6 hex digits, got %d", len(hexKey))
+	}
+	seed, err := strconv.ParseUint(hexKey, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode scrambler key: %w", err)
+	}
+	if seed == 0 {
+		return nil, fmt.Errorf("scrambler key must not be zero")
+	}
+	return &scramblerKey{seed: uint32(seed), subtype: uint16(len(hexKey)/2 - 1)}, nil
+}
+
+// scrambler generates the keystream for one stream. The LFSR runs
+// continuously from the seed, 128 bits per frame.
+type scrambler struct {
+	key      *scramblerKey
+	lfsr     uint32
+	position int // frames the LFSR has run since the seed, across frame number wraps
+}
+
+// newScrambler returns a scrambler positioned at the first frame
+func newScrambler(key *scramblerKey) *scrambler {
+	return &scrambler{key: key, lfsr: key.seed}
+}
+
+// next advances the LFSR by one bit and returns it
+func (s *scrambler) next() uint32 {
+	taps := scramblerTaps[s.key.subtype]
+	bit := (s.lfsr>>taps[0] ^ s.lfsr>>taps[1] ^ s.lfsr>>taps[2] ^ s.lfsr>>taps[3]) & 1
+	mask := uint32(1)<<(8*(s.key.subtype+1)) - 1
+	s.lfsr = (s.lfsr<<1 | bit) & mask
+	return bit
+}
+
+// descramble XORs a stream payload with the keystream for its frame. Frames
+// that arrive out of sequence rewind or skip the LFSR to stay in step; the
+// 15-bit frame number is compared with frameAfter so the keystream carries
+// on when it wraps.
+func (s *scrambler) descramble(frameNumber uint16, payload []byte) []byte {
+	frameNumber &= m17.FrameNumberMask
+	frame := uint16(s.position) & m17.FrameNumberMask
+	target := s.position + int((frameNumber-frame)&m17.FrameNumberMask)
+	if frameNumber != frame && !frameAfter(frameNumber, frame) {
+		target = s.position - int((frame-frameNumber)&m17.FrameNumberMask)
+		if target < 0 {
+			// Joined mid-stream at a frame number far from zero
+			target = int(frameNumber)
+		}
+	}
+
+	if target < s.position {
+		s.lfsr, s.position = s.key.seed, 0
+	}
+	for ; s.position < target; s.position++ {
+		for i := 0; i < 8*len(payload); i++ {
+			s.next()
+		}
+	}
+
+	plain := make([]byte, len(payload))
+	for i := range payload {
+		var b byte
+		for j := 0; j < 8; j++ {
+			b = b<<1 | byte(s.next())
+		}
+		plain[i] = payload[i] ^ b
+	}
+	s.position++
+	return plain
+}
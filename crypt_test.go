@@ -0,0 +1,187 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// unhex decodes a hex string in a test table
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestNewScramblerKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		seed    uint32
+		subtype uint16
+		wantErr bool
+	}{
+		{"A5", 0xA5, 0, false},
+		{"0x1234", 0x1234, 1, false},
+		{" abcdef ", 0xABCDEF, 2, false},
+		{"00A5", 0xA5, 1, false},
+		{"ABC", 0, 0, true},
+		{"12345678", 0, 0, true},
+		{"00", 0, 0, true},
+		{"ZZ", 0, 0, true},
+		{"", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			k, err := newScramblerKey(tt.key)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("newScramblerKey(%q) = %+v, want an error", tt.key, k)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.seed != tt.seed || k.subtype != tt.subtype {
+				t.Errorf("newScramblerKey(%q) = seed %#x subtype %d, want %#x and %d", tt.key, k.seed, k.subtype, tt.seed, tt.subtype)
+			}
+		})
+	}
+}
+
+func TestDescramble(t *testing.T) {
+	// Keystreams of the first two frames from the reference LFSR, and the
+	// first frame of "M17 scrambler ok" scrambled with it
+	tests := []struct {
+		name      string
+		key       string
+		frame0    string
+		frame1    string
+		scrambled string
+	}{
+		{"8-bit seed", "A5", "4eecf7e99a8c1d57ca13fc2f1a023897", "0324dc82b6b2c3edeba21b1e7316914a", "03ddc0c9e9ef6f36a771904a682257fc"},
+		{"16-bit seed", "1234", "e96cbb6671810e6dba7cd065a9129a03", "4ab4c61ad781d91d74847e4bcc4653c4", "a45d8c4602e27c0cd71ebc00db32f568"},
+		{"24-bit seed", "ABCDEF", "b59654c3c9cfaf9ab98399ed463b21cf", "3102f51676405863edb8dd5c44bcb781", "f8a763e3baacddfbd4e1f588341b4ea4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := newScramblerKey(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := newScrambler(key)
+			if got := s.descramble(0, unhex(t, tt.scrambled)); string(got) != "M17 scrambler ok" {
+				t.Errorf("frame 0 descrambled to %q, want %q", got, "M17 scrambler ok")
+			}
+			if got := s.descramble(1, make([]byte, 16)); !bytes.Equal(got, unhex(t, tt.frame1)) {
+				t.Errorf("frame 1 keystream = %x, want %s", got, tt.frame1)
+			}
+
+			// A late frame rewinds the LFSR and the next frame skips ahead
+			if got := s.descramble(0, make([]byte, 16)); !bytes.Equal(got, unhex(t, tt.frame0)) {
+				t.Errorf("frame 0 keystream after rewinding = %x, want %s", got, tt.frame0)
+			}
+			if got := newScrambler(key).descramble(1|0x8000, make([]byte, 16)); !bytes.Equal(got, unhex(t, tt.frame1)) {
+				t.Errorf("last frame 1 keystream = %x, want %s", got, tt.frame1)
+			}
+		})
+	}
+}
+
+func TestDescrambleWrap(t *testing.T) {
+	key, err := newScramblerKey("ABCDEF")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The keystream of the frames after the 15-bit frame number wraps,
+	// straight from the LFSR
+	ref := newScrambler(key)
+	for i := 0; i < 0x8000*128; i++ {
+		ref.next()
+	}
+	want := make([]byte, 32)
+	for i := range want {
+		for j := 0; j < 8; j++ {
+			want[i] = want[i]<<1 | byte(ref.next())
+		}
+	}
+
+	s := newScrambler(key)
+	s.descramble(0x7FFE, make([]byte, 16))
+	s.descramble(0x7FFF, make([]byte, 16))
+	if got := s.descramble(0, make([]byte, 16)); !bytes.Equal(got, want[:16]) {
+		t.Errorf("keystream after the wrap = %x, want %x", got, want[:16])
+	}
+	s.descramble(0x7FFF, make([]byte, 16))
+	if got := s.descramble(1, make([]byte, 16)); !bytes.Equal(got, want[16:]) {
+		t.Errorf("keystream after a late frame across the wrap = %x, want %x", got, want[16:])
+	}
+}
+
+func TestAESDecrypt(t *testing.T) {
+	// NIST SP 800-38A example vectors: the counter block is the nonce and
+	// frame number, so it encrypts to the keystream for the frame
+	const nonce, frameNumber = "6bc1bee22e409f96e93d7e117393", 0x172a
+	tests := []struct {
+		name      string
+		key       string
+		keystream string
+	}{
+		{"AES-128", "2b7e151628aed2a6abf7158809cf4f3c", "3ad77bb40d7a3660a89ecaf32466ef97"},
+		{"AES-192", "8e73b0f7da0e6452c810f32b809079e562f8ead2522c6b7b", "bd334f1d6e45f25ff712a214571fa5cc"},
+		{"AES-256", "603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", "f3eed1bdb5d2a03c064b5a7e3db181f8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := newAESKey(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.size != len(tt.key)/2 {
+				t.Errorf("key size = %d, want %d", k.size, len(tt.key)/2)
+			}
+
+			meta := unhex(t, nonce)
+			want := []byte("M17 AES payload!")
+			payload := make([]byte, len(want))
+			for i, b := range unhex(t, tt.keystream) {
+				payload[i] = want[i] ^ b
+			}
+			for _, fn := range []uint16{frameNumber, frameNumber | 0x8000} {
+				if got := k.decrypt(meta, fn, payload); !bytes.Equal(got, want) {
+					t.Errorf("frame %#04x decrypted to %q, want %q", fn, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewAESKeyInvalid(t *testing.T) {
+	for _, key := range []string{"", "2b7e", "2b7e151628aed2a6abf7158809cf4f3", "not hex at all!!"} {
+		if k, err := newAESKey(key); err == nil {
+			t.Errorf("newAESKey(%q) = %+v, want an error", key, k)
+		}
+	}
+}
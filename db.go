@@ -0,0 +1,174 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go SQLite driver, registered as "sqlite"
+)
+
+// dbQueueSize is how many finished transmissions may wait to be written
+const dbQueueSize = 256
+
+// dbSchema creates the transmissions table if it is missing. Times are
+// stored as RFC 3339 UTC text so they sort and read naturally.
+const dbSchema = `
+CREATE TABLE IF NOT EXISTS transmissions (
+	id            INTEGER PRIMARY KEY,
+	started       TEXT    NOT NULL,
+	src           TEXT    NOT NULL,
+	dst           TEXT    NOT NULL,
+	stream_id     INTEGER NOT NULL,
+	duration      REAL    NOT NULL,
+	frames        INTEGER NOT NULL,
+	crc_errors    INTEGER NOT NULL,
+	decode_errors INTEGER NOT NULL,
+	timed_out     INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS transmissions_started ON transmissions (started);
+`
+
+// dbInsert inserts one transmission
+const dbInsert = `INSERT INTO transmissions
+	(started, src, dst, stream_id, duration, frames, crc_errors, decode_errors, timed_out)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// transmission is a finished stream as stored in the database
+type transmission struct {
+	started      time.Time
+	src          string
+	dst          string
+	streamID     uint16
+	duration     float64 // seconds
+	frames       int
+	crcErrors    int
+	decodeErrors int
+	timedOut     bool
+}
+
+// heardDB writes finished transmissions to a SQLite database from a single
+// goroutine, so database I/O never blocks decoding
+type heardDB struct {
+	db    *sql.DB
+	queue chan transmission
+	done  chan struct{}
+}
+
+// openHeardDB opens or creates the database at path and starts its writer
+func openHeardDB(path string) (*heardDB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	// SQLite allows one writer, and all writes come from one goroutine
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(dbSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create database schema in %s: %w", path, err)
+	}
+
+	h := &heardDB{
+		db:    db,
+		queue: make(chan transmission, dbQueueSize),
+		done:  make(chan struct{}),
+	}
+	go h.run()
+	return h, nil
+}
+
+// record queues a finished stream for writing, dropping it if the writer
+// has fallen too far behind
+func (h *heardDB) record(s *stream, timedOut bool) {
+	t := transmission{
+		started:      s.started,
+		src:          s.src,
+		dst:          s.dst,
+		streamID:     s.id,
+		duration:     s.lastSeen.Sub(s.started).Seconds(),
+		frames:       s.packets,
+		crcErrors:    s.crcErrors,
+		decodeErrors: s.decodeErrors,
+		timedOut:     timedOut,
+	}
+
+	select {
+	case h.queue <- t:
+	default:
+		slog.Warn("database queue full, dropping transmission", "streamID", hex16(s.id))
+	}
+}
+
+// run writes queued transmissions until the queue is closed, batching any
+// that have piled up into one transaction
+func (h *heardDB) run() {
+	defer close(h.done)
+
+	for t := range h.queue {
+		batch := []transmission{t}
+	drain:
+		for len(batch) < dbQueueSize {
+			select {
+			case t, ok := <-h.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, t)
+			default:
+				break drain
+			}
+		}
+		if err := h.insert(batch); err != nil {
+			slog.Error("failed to write transmissions to database", "count", len(batch), "err", err)
+		}
+	}
+}
+
+// insert writes a batch of transmissions in one transaction
+func (h *heardDB) insert(batch []transmission) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(dbInsert)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, t := range batch {
+		_, err := stmt.Exec(t.started.UTC().Format(time.RFC3339Nano), t.src, t.dst, t.streamID,
+			t.duration, t.frames, t.crcErrors, t.decodeErrors, t.timedOut)
+		if err != nil {
+			return fmt.Errorf("failed to insert transmission: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Close writes any queued transmissions and closes the database
+func (h *heardDB) Close() error {
+	close(h.queue)
+	<-h.done
+	return h.db.Close()
+}
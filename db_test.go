@@ -0,0 +1,121 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHeardDBRecord(t *testing.T) {
+	started := time.Date(2024, 3, 1, 12, 0, 5, 250_000_000, time.UTC)
+	tests := []struct {
+		name     string
+		stream   stream
+		timedOut bool
+	}{
+		{"ended", stream{id: 0x1234, src: "KC1AWV", dst: "M17-XXX A", started: started,
+			lastSeen: started.Add(1500 * time.Millisecond), packets: 38}, false},
+		{"timed out with errors", stream{id: 0xBEEF, src: "N0CALL", dst: "@ALL", started: started.Add(time.Minute),
+			lastSeen: started.Add(time.Minute + 400*time.Millisecond), packets: 10, crcErrors: 2, decodeErrors: 1}, true},
+	}
+
+	path := filepath.Join(t.TempDir(), "heard.db")
+	h, err := openHeardDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		h.record(&tt.stream, tt.timedOut)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT started, src, dst, stream_id, duration, frames, crc_errors, decode_errors, timed_out
+		FROM transmissions ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !rows.Next() {
+				t.Fatalf("row missing: %v", rows.Err())
+			}
+			var got transmission
+			var when string
+			if err := rows.Scan(&when, &got.src, &got.dst, &got.streamID, &got.duration,
+				&got.frames, &got.crcErrors, &got.decodeErrors, &got.timedOut); err != nil {
+				t.Fatal(err)
+			}
+			if got.started, err = time.Parse(time.RFC3339Nano, when); err != nil {
+				t.Fatal(err)
+			}
+
+			s := tt.stream
+			want := transmission{s.started, s.src, s.dst, s.id, s.lastSeen.Sub(s.started).Seconds(),
+				s.packets, s.crcErrors, s.decodeErrors, tt.timedOut}
+			if !got.started.Equal(want.started) {
+				t.Errorf("started = %s, want %s", got.started, want.started)
+			}
+			got.started = want.started
+			if got != want {
+				t.Errorf("read back %+v, want %+v", got, want)
+			}
+		})
+	}
+	if rows.Next() {
+		t.Error("more rows than transmissions recorded")
+	}
+}
+
+func TestHeardDBReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heard.db")
+	for i := 0; i < 2; i++ {
+		h, err := openHeardDB(path)
+		if err != nil {
+			t.Fatalf("open #%d: %v", i, err)
+		}
+		h.record(&stream{id: uint16(i), src: "KC1AWV", dst: "M17-XXX A"}, false)
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM transmissions`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("database holds %d transmissions after reopening, want 2", n)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// maxDedupEntries caps the fingerprints remembered regardless of the window
+const maxDedupEntries = 4096
+
+// dedupEntry is a remembered frame fingerprint
+type dedupEntry struct {
+	fingerprint uint64
+	seen        time.Time
+}
+
+// dedupWindow remembers recently seen frames so echoes of the same audio can
+// be skipped
+type dedupWindow struct {
+	window  time.Duration
+	seen    map[uint64]struct{}
+	entries []dedupEntry // oldest first
+}
+
+// newDedupWindow creates a window remembering frames for the given duration
+func newDedupWindow(window time.Duration) *dedupWindow {
+	return &dedupWindow{
+		window: window,
+		seen:   make(map[uint64]struct{}),
+	}
+}
+
+// frameFingerprint identifies a frame by its source, destination, frame
+// number and payload. The StreamID is left out because a reflector echoing
+// traffic back may assign a new one.
+func frameFingerprint(src, dst string, frameNumber uint16, payload []byte) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(src))
+	h.Write([]byte{0})
+	h.Write([]byte(dst))
+	h.Write([]byte{0, byte(frameNumber >> 8), byte(frameNumber)})
+	h.Write(payload)
+	return h.Sum64()
+}
+
+// duplicate reports whether a fingerprint was seen within the window, and
+// remembers it if not
+func (d *dedupWindow) duplicate(fingerprint uint64, now time.Time) bool {
+	// Forget fingerprints that have aged out or overflowed the cap
+	for len(d.entries) > 0 && (now.Sub(d.entries[0].seen) > d.window || len(d.entries) >= maxDedupEntries) {
+		delete(d.seen, d.entries[0].fingerprint)
+		d.entries = d.entries[1:]
+	}
+
+	if _, ok := d.seen[fingerprint]; ok {
+		return true
+	}
+	d.seen[fingerprint] = struct{}{}
+	d.entries = append(d.entries, dedupEntry{fingerprint: fingerprint, seen: now})
+	return false
+}
@@ -0,0 +1,94 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go-m17gateway-monitor/m17"
+)
+
+func TestDedupWindow(t *testing.T) {
+	a := frameFingerprint("N0CALL", "M17-XXX A", 0, make([]byte, m17.PayloadSize))
+	b := frameFingerprint("N0CALL", "M17-XXX A", 1, make([]byte, m17.PayloadSize))
+	type check struct {
+		fingerprint uint64
+		after       time.Duration
+		want        bool
+	}
+	tests := []struct {
+		name   string
+		checks []check
+	}{
+		{"echo within the window", []check{{a, 0, false}, {a, 100 * time.Millisecond, true}}},
+		{"different frames", []check{{a, 0, false}, {b, 0, false}}},
+		{"echo at the window", []check{{a, 0, false}, {a, time.Second, true}}},
+		{"repeat after the window", []check{{a, 0, false}, {a, time.Second + time.Millisecond, false}}},
+		{"repeat remembered afresh", []check{{a, 0, false}, {a, 2 * time.Second, false}, {a, 2500 * time.Millisecond, true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDedupWindow(time.Second)
+			start := time.Now()
+			for i, c := range tt.checks {
+				if got := d.duplicate(c.fingerprint, start.Add(c.after)); got != c.want {
+					t.Errorf("check #%d at %s = %t, want %t", i, c.after, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupWindowCap(t *testing.T) {
+	d := newDedupWindow(time.Hour)
+	now := time.Now()
+	for i := uint64(0); i < maxDedupEntries+10; i++ {
+		d.duplicate(i, now)
+	}
+	if len(d.entries) > maxDedupEntries || len(d.seen) > maxDedupEntries {
+		t.Errorf("remembering %d entries and %d fingerprints, want at most %d", len(d.entries), len(d.seen), maxDedupEntries)
+	}
+	if d.duplicate(0, now) {
+		t.Error("oldest fingerprint still remembered past the cap")
+	}
+}
+
+func TestDedupEcho(t *testing.T) {
+	tests := []struct {
+		name   string
+		dedup  int
+		played int
+	}{
+		{"dedup on", 1000, 1},
+		{"dedup off", 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{Dedup: tt.dedup})
+
+			// A reflector echoing the frame back may give it a new StreamID
+			for _, id := range []uint16{1, 2} {
+				c.handleStreamFrame("", makeFrame(t, id, "N0CALL", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize)))
+			}
+			if len(*frames) != tt.played {
+				t.Errorf("played %d frames, want %d", len(*frames), tt.played)
+			}
+		})
+	}
+}
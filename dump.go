@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// dumpM17 writes a hex dump of an M17 packet followed by its decoded fields
+func dumpM17(w io.Writer, packet []byte) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "M17 packet, %d bytes\n", len(packet))
+	b.WriteString(hex.Dump(packet))
+
+	if len(packet) != m17.StreamFrameSize {
+		fmt.Fprintf(&b, "  not a %d-byte stream frame\n\n", m17.StreamFrameSize)
+		io.WriteString(w, b.String())
+		return
+	}
+
+	frameNumber := binary.BigEndian.Uint16(packet[34:36])
+	fmt.Fprintf(&b, "  StreamID: 0x%04X\n", binary.BigEndian.Uint16(packet[4:6]))
+	fmt.Fprintf(&b, "  FN:       %d", frameNumber&m17.FrameNumberMask)
+	if frameNumber&m17.LastFrameFlag != 0 {
+		b.WriteString(" (last)")
+	}
+	b.WriteString("\n")
+
+	if lsf, err := m17.ParseLSF(packet[6:34]); err != nil {
+		fmt.Fprintf(&b, "  LSF:      %v\n", err)
+	} else {
+		mode := "packet"
+		if lsf.IsStream() {
+			mode = "stream"
+		}
+		fmt.Fprintf(&b, "  DST:      %s\n", lsf.Dst)
+		fmt.Fprintf(&b, "  SRC:      %s\n", lsf.Src)
+		fmt.Fprintf(&b, "  TYPE:     0x%04X %s, %s, encryption %s/%s, CAN %d",
+			lsf.Type, mode, lsf.DataTypeName(), lsf.EncryptionName(), lsf.EncryptionSubtypeName(), lsf.ChannelAccessNumber())
+		if reserved := lsf.Reserved(); reserved != 0 {
+			fmt.Fprintf(&b, ", reserved 0x%04X", reserved)
+		}
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "  META:     %x", lsf.Meta)
+		if info, ok := parseMeta(lsf); ok {
+			fmt.Fprintf(&b, " (%s)", info)
+		}
+		b.WriteString("\n")
+	}
+
+	crc, want := binary.BigEndian.Uint16(packet[52:54]), m17.CRC(packet[:52])
+	if crc == want {
+		fmt.Fprintf(&b, "  CRC:      0x%04X ok\n\n", crc)
+	} else {
+		fmt.Fprintf(&b, "  CRC:      0x%04X mismatch, want 0x%04X\n\n", crc, want)
+	}
+
+	io.WriteString(w, b.String())
+}
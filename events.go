@@ -0,0 +1,137 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	eventStart     = "start"
+	eventEnd       = "end"
+	eventPacket    = "packet"
+	eventHeartbeat = "heartbeat"
+	eventPosition  = "position"
+)
+
+// DefaultHeartbeat is the default number of seconds between heartbeat events
+const DefaultHeartbeat = 30
+
+// Event describes a stream start or end, a reported position, received packet
+// data or a heartbeat
+type Event struct {
+	Seq          uint64    `json:"seq"` // increases by one for every event emitted
+	Type         string    `json:"type"`
+	StreamID     uint16    `json:"streamID"`
+	Source       string    `json:"source,omitempty"` // address of the reflector or sender, e.g. "192.0.2.1:17000"
+	Src          string    `json:"src"`
+	SrcName      string    `json:"srcName,omitempty"` // operator name from the roster
+	Dst          string    `json:"dst"`
+	DstBase      string    `json:"dstBase"`             // Dst without the module
+	DstModule    string    `json:"dstModule,omitempty"` // reflector module, e.g. "A"
+	Timestamp    time.Time `json:"timestamp"`
+	Frames       int       `json:"frames"`
+	Duration     float64   `json:"duration"` // seconds
+	TimedOut     bool      `json:"timedOut,omitempty"`
+	CRCErrors    int       `json:"crcErrors,omitempty"`
+	DecodeErrors int       `json:"decodeErrors,omitempty"`
+	PacketType   string    `json:"packetType,omitempty"`
+	ReservedBits string    `json:"reservedBits,omitempty"` // reserved LSF TYPE bits, in hex, when any are set
+	Text         string    `json:"text,omitempty"`
+	Position     *Position `json:"position,omitempty"`
+	Uptime       float64   `json:"uptime,omitempty"`        // seconds, heartbeats only
+	Active       *int      `json:"activeStreams,omitempty"` // heartbeats only
+}
+
+// eventTimeFormat is RFC 3339 with fixed millisecond precision
+const eventTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// MarshalJSON encodes the event with its timestamp in UTC in eventTimeFormat
+func (ev Event) MarshalJSON() ([]byte, error) {
+	type plain Event
+	return json.Marshal(struct {
+		plain
+		Timestamp string `json:"timestamp"`
+	}{plain(ev), ev.Timestamp.UTC().Format(eventTimeFormat)})
+}
+
+// streamEvent builds an event from a tracked stream
+func streamEvent(typ string, s *stream) Event {
+	ev := Event{
+		Type:     typ,
+		StreamID: s.id,
+		Source:   s.origin,
+		Src:      s.src,
+		SrcName:  s.name,
+		Dst:      s.dst,
+		Frames:   s.packets,
+	}
+	ev.DstBase, ev.DstModule = splitDestination(s.dst)
+	if s.reserved != 0 {
+		ev.ReservedBits = hex16(s.reserved)
+	}
+
+	if typ == eventStart {
+		ev.Timestamp = s.started
+	} else {
+		ev.Timestamp = s.lastSeen
+		ev.Duration = s.lastSeen.Sub(s.started).Seconds()
+		ev.CRCErrors = s.crcErrors
+		ev.DecodeErrors = s.decodeErrors
+		if s.text != nil {
+			ev.Text = s.text.message()
+		}
+		ev.Position = s.position
+	}
+
+	return ev
+}
+
+// eventEmitter writes events as newline-delimited JSON
+type eventEmitter struct {
+	mu      sync.Mutex
+	enabled bool
+	enc     *json.Encoder
+}
+
+// newEventEmitter creates an event emitter writing to w when enabled
+func newEventEmitter(enabled bool, w io.Writer) *eventEmitter {
+	return &eventEmitter{
+		enabled: enabled,
+		enc:     json.NewEncoder(w),
+	}
+}
+
+// emit writes a single event
+func (e *eventEmitter) emit(ev Event) {
+	if !e.enabled {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.enc.Encode(ev); err != nil {
+		slog.Error("failed to emit event", "err", err)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEventSequence(t *testing.T) {
+	c, _ := newTestClient(t, Config{})
+	events := captureEvents(t, c)
+	for _, typ := range []string{eventStart, eventPacket, eventEnd, eventHeartbeat} {
+		c.emitEvent(Event{Type: typ})
+	}
+
+	got := events()
+	if len(got) != 4 {
+		t.Fatalf("emitted %d events, want 4", len(got))
+	}
+	for i, ev := range got {
+		if want := uint64(i + 1); ev.Seq != want {
+			t.Errorf("event %d (%s) has seq %d, want %d", i, ev.Type, ev.Seq, want)
+		}
+	}
+}
+
+func TestEventTimestamp(t *testing.T) {
+	tests := []struct {
+		name string
+		ts   time.Time
+		want string
+	}{
+		{"whole second", time.Date(2024, 3, 1, 12, 0, 5, 0, time.UTC), "2024-03-01T12:00:05.000Z"},
+		{"milliseconds", time.Date(2024, 3, 1, 12, 0, 5, 42_000_000, time.UTC), "2024-03-01T12:00:05.042Z"},
+		{"truncated", time.Date(2024, 3, 1, 12, 0, 5, 999_999_999, time.UTC), "2024-03-01T12:00:05.999Z"},
+		{"converted to UTC", time.Date(2024, 3, 1, 7, 0, 5, 0, time.FixedZone("EST", -5*3600)), "2024-03-01T12:00:05.000Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			newEventEmitter(true, &buf).emit(Event{Type: eventStart, Timestamp: tt.ts})
+
+			var raw map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+				t.Fatal(err)
+			}
+			if raw["timestamp"] != tt.want {
+				t.Errorf("timestamp = %v, want %q", raw["timestamp"], tt.want)
+			}
+		})
+	}
+}
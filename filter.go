@@ -0,0 +1,64 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import "strings"
+
+// callsignFilter decides which callsigns to accept. A callsign on the deny
+// list is always rejected; otherwise an empty allow list accepts everything.
+type callsignFilter struct {
+	allow map[string]struct{}
+	deny  map[string]struct{}
+}
+
+// newCallsignFilter builds a filter from comma-separated allow and deny lists
+func newCallsignFilter(allow, deny string) callsignFilter {
+	return callsignFilter{
+		allow: callsignSet(allow),
+		deny:  callsignSet(deny),
+	}
+}
+
+// callsignSet parses a comma-separated list of callsigns
+func callsignSet(list string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, callsign := range strings.Split(list, ",") {
+		if callsign = normalizeCallsign(callsign); callsign != "" {
+			set[callsign] = struct{}{}
+		}
+	}
+	return set
+}
+
+// normalizeCallsign trims base40 padding and upper-cases a callsign for matching
+func normalizeCallsign(callsign string) string {
+	return strings.ToUpper(strings.TrimSpace(callsign))
+}
+
+// permits reports whether a callsign passes the filter
+func (f callsignFilter) permits(callsign string) bool {
+	callsign = normalizeCallsign(callsign)
+	if _, denied := f.deny[callsign]; denied {
+		return false
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	_, allowed := f.allow[callsign]
+	return allowed
+}
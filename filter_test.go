@@ -0,0 +1,69 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"go-m17gateway-monitor/m17"
+)
+
+func TestCallsignFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		allow    string
+		deny     string
+		callsign string
+		want     bool
+	}{
+		{"no lists", "", "", "KC1AWV", true},
+		{"allowed", "KC1AWV,N0CALL", "", "N0CALL", true},
+		{"not allowed", "KC1AWV,N0CALL", "", "W1AW", false},
+		{"denied", "", "BRIDGE", "BRIDGE", false},
+		{"not denied", "", "BRIDGE", "KC1AWV", true},
+		{"deny wins", "KC1AWV", "KC1AWV", "KC1AWV", false},
+		{"padded callsign", "KC1AWV", "", "KC1AWV   ", true},
+		{"padded list", " KC1AWV , N0CALL ", "", "N0CALL", true},
+		{"padded deny", "", " BRIDGE ", "BRIDGE  ", false},
+		{"lower case list", "kc1awv", "", "KC1AWV", true},
+		{"module kept", "M17-XXX A", "", "M17-XXX A", true},
+		{"other module", "M17-XXX A", "", "M17-XXX B", false},
+		{"empty entries", ",,", "", "KC1AWV", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newCallsignFilter(tt.allow, tt.deny)
+			if got := f.permits(tt.callsign); got != tt.want {
+				t.Errorf("allow %q deny %q permits(%q) = %t, want %t", tt.allow, tt.deny, tt.callsign, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceFilter(t *testing.T) {
+	c, frames := newTestClient(t, Config{SrcAllow: "KC1AWV,N0CALL", SrcDeny: "N0CALL"})
+	for i, src := range []string{"KC1AWV", "N0CALL", "W1AW"} {
+		c.handleStreamFrame("", makeFrame(t, uint16(i), src, "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize)))
+	}
+	if len(*frames) != 1 || (*frames)[0].Src != "KC1AWV" {
+		t.Errorf("decoded %d frames, want only the one from KC1AWV", len(*frames))
+	}
+	if got := c.metrics.filtered.Load(); got != 2 {
+		t.Errorf("filtered %d frames, want 2", got)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+// Frame is a decoded M17 voice frame
+type Frame struct {
+	StreamID    uint16
+	Source      string // address of the reflector or sender, e.g. "192.0.2.1:17000"
+	Src         string
+	Dst         string
+	Type        uint16
+	Meta        []byte
+	FrameNumber uint16
+	IsLast      bool
+	Audio       []int16 // 8 kHz samples from both Codec 2 frames
+}
+
+// FrameHandler receives decoded voice frames
+type FrameHandler interface {
+	HandleFrame(f *Frame)
+}
+
+// FrameHandlerFunc adapts an ordinary function to a FrameHandler
+type FrameHandlerFunc func(f *Frame)
+
+// HandleFrame calls fn(f)
+func (fn FrameHandlerFunc) HandleFrame(f *Frame) {
+	fn(f)
+}
+
+// frameSinks fans each decoded frame out to several handlers in turn
+type frameSinks []FrameHandler
+
+// HandleFrame passes the frame to every handler
+func (s frameSinks) HandleFrame(f *Frame) {
+	for _, h := range s {
+		h.HandleFrame(f)
+	}
+}
+
+// playbackHandler is the default handler, playing frames through the audio device
+type playbackHandler struct {
+	client *Client
+}
+
+// HandleFrame plays the frame audio
+func (h playbackHandler) HandleFrame(f *Frame) {
+	h.client.playAudio(f.Audio)
+}
+
+// SetFrameHandler replaces the handler for decoded frames, which plays them
+// by default. Outputs added with AddFrameHandler keep receiving frames. It
+// must be called before the client is started.
+func (c *Client) SetFrameHandler(h FrameHandler) {
+	c.handler = h
+}
+
+// AddFrameHandler adds an output that receives every decoded frame alongside
+// the others. It must be called before the client is started.
+func (c *Client) AddFrameHandler(h FrameHandler) {
+	c.sinks = append(c.sinks, h)
+}
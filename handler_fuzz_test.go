@@ -0,0 +1,56 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"go-m17gateway-monitor/m17"
+)
+
+func FuzzHandlePacket(f *testing.F) {
+	// Seed with every length boundary: a stream frame one byte either side
+	// of its size, and a packet datagram either side of its header
+	frame := append(makeFrame(f, 1, "N0CALL", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize)), 0)
+	for _, n := range []int{0, m17.StreamFrameSize - 1, m17.StreamFrameSize, m17.StreamFrameSize + 1} {
+		f.Add(frame[:n])
+	}
+	packet := append([]byte(m17.MagicPacket), make([]byte, m17.LSFSize+3)...)
+	for _, n := range []int{m17.PacketHeaderSize - 1, m17.PacketHeaderSize + 1} {
+		f.Add(packet[:n])
+	}
+
+	c, err := newClient(Config{NoSound: true, StreamTimeout: DefaultStreamTimeout, Packets: true, FillGaps: true, HighPass: true})
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer c.Close()
+	c.SetFrameHandler(FrameHandlerFunc(func(*Frame) {}))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		c.handlePacket("", b)
+
+		// Most random stream frames fail the CRC, so also try each one
+		// with a valid CRC to reach the decoder
+		if len(b) == m17.StreamFrameSize {
+			p := append([]byte(m17.MagicStream), b[4:52]...)
+			crc := m17.CRC(p)
+			c.handlePacket("", append(p, byte(crc>>8), byte(crc)))
+		}
+	})
+}
@@ -0,0 +1,147 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import "sync"
+
+// jitterTick is the release cadence of the jitter buffer, one stream frame
+const jitterTick = frameDuration
+
+// maxJitterStreams bounds the streams buffered at once. Real traffic has a
+// handful; more means a flood of StreamIDs, whose new streams are dropped.
+const maxJitterStreams = 64
+
+// jitterFrame is a buffered stream frame
+type jitterFrame struct {
+	number uint16
+	packet []byte
+}
+
+// jitterPacket is a stream frame released from the jitter buffer, with the
+// address it came from
+type jitterPacket struct {
+	origin string
+	packet []byte
+}
+
+// jitterStream is the buffer for one stream
+type jitterStream struct {
+	frames   []jitterFrame // ordered by frame number
+	waited   int           // ticks spent filling before release started
+	primed   bool          // filled to depth once, so frames are being released
+	ended    bool          // the last frame has arrived
+	released uint16        // number of the last frame released
+}
+
+// jitterBuffer holds stream frames briefly so frames arriving out of order
+// can be put back in order, then releases one frame per stream every tick
+type jitterBuffer struct {
+	mu      sync.Mutex
+	depth   int
+	streams map[streamKey]*jitterStream
+}
+
+// newJitterBuffer creates a jitter buffer holding depth frames per stream
+// before it starts releasing them
+func newJitterBuffer(depth int) *jitterBuffer {
+	return &jitterBuffer{
+		depth:   depth,
+		streams: make(map[streamKey]*jitterStream),
+	}
+}
+
+// add buffers a frame. Duplicates, frames older than one already released,
+// frames beyond twice the depth and streams beyond maxJitterStreams, which
+// only a flood or a runaway sender produces, are dropped. add reports whether
+// the frame was kept.
+func (j *jitterBuffer) add(origin string, id, frameNumber uint16, isLast bool, packet []byte) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key := streamKey{origin, id}
+	s, ok := j.streams[key]
+	if !ok {
+		if len(j.streams) >= maxJitterStreams {
+			return false
+		}
+		s = &jitterStream{}
+		j.streams[key] = s
+	}
+	if s.primed && !frameAfter(frameNumber, s.released) || len(s.frames) >= 2*j.depth {
+		return false
+	}
+
+	// Insert in order, searching from the newest end where most frames land
+	i := len(s.frames)
+	for i > 0 && frameAfter(s.frames[i-1].number, frameNumber) {
+		i--
+	}
+	if i > 0 && s.frames[i-1].number == frameNumber {
+		return false
+	}
+	s.frames = append(s.frames, jitterFrame{})
+	copy(s.frames[i+1:], s.frames[i:])
+	s.frames[i] = jitterFrame{number: frameNumber, packet: append([]byte(nil), packet...)}
+
+	if isLast {
+		s.ended = true
+	}
+	return true
+}
+
+// tick returns the frames due for release: the oldest frame of every primed
+// stream, or all frames of a stream whose last frame has arrived. A stream is
+// primed once it holds depth frames or has waited depth ticks, so a short
+// stream is not held forever. Streams that have run dry are forgotten, so a
+// StreamID seen again starts afresh.
+func (j *jitterBuffer) tick() []jitterPacket {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var out []jitterPacket
+	for key, s := range j.streams {
+		switch {
+		case s.ended:
+			for _, f := range s.frames {
+				out = append(out, jitterPacket{key.origin, f.packet})
+			}
+			delete(j.streams, key)
+			continue
+		case len(s.frames) == 0:
+			delete(j.streams, key)
+			continue
+		case len(s.frames) >= j.depth || s.waited >= j.depth:
+			s.primed = true
+		}
+		s.waited++
+		if s.primed {
+			out = append(out, jitterPacket{key.origin, s.frames[0].packet})
+			s.released = s.frames[0].number
+			s.frames = s.frames[1:]
+		}
+	}
+	return out
+}
+
+// flush drops every buffered frame
+func (j *jitterBuffer) flush() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	clear(j.streams)
+}
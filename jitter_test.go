@@ -0,0 +1,92 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestJitterBufferStreamLimit(t *testing.T) {
+	j := newJitterBuffer(3)
+	for id := uint16(0); id < maxJitterStreams; id++ {
+		if !j.add("", id, 0, false, []byte{0}) {
+			t.Fatalf("stream %d dropped below the limit", id)
+		}
+	}
+	if j.add("", maxJitterStreams, 0, false, []byte{0}) {
+		t.Error("stream beyond the limit kept")
+	}
+	if !j.add("", 0, 1, false, []byte{1}) {
+		t.Error("frame of a buffered stream dropped at the limit")
+	}
+	if len(j.streams) != maxJitterStreams {
+		t.Errorf("buffering %d streams, want %d", len(j.streams), maxJitterStreams)
+	}
+}
+
+func TestJitterBufferOrder(t *testing.T) {
+	// A step adds a frame and checks whether it was kept, or ticks and
+	// checks the frames released
+	type step struct {
+		tick     bool
+		frame    uint16
+		last     bool
+		kept     bool
+		released []uint16
+	}
+	add := func(frame uint16, kept bool) step { return step{frame: frame, kept: kept} }
+	last := func(frame uint16) step { return step{frame: frame, last: true, kept: true} }
+	tick := func(released ...uint16) step { return step{tick: true, released: released} }
+
+	tests := []struct {
+		name  string
+		depth int
+		steps []step
+	}{
+		{"in order", 2, []step{add(0, true), add(1, true), tick(0), tick(1), tick()}},
+		{"reordered", 3, []step{add(0, true), add(2, true), add(1, true), tick(0), tick(1), tick(2)}},
+		{"duplicate", 3, []step{add(0, true), add(1, true), add(1, false), add(2, true), tick(0), tick(1), tick(2), tick()}},
+		{"late", 2, []step{add(0, true), add(1, true), tick(0), add(0, false), add(2, true), tick(1), tick(2)}},
+		{"late after wrap", 2, []step{add(0xFFFE, true), add(0xFFFF, true), tick(0xFFFE), add(0, true), tick(0xFFFF), add(0xFFFE, false), tick(0)}},
+		{"beyond twice the depth", 2, []step{add(0, true), add(1, true), add(2, true), add(3, true), add(4, false)}},
+		{"last frame flushes", 3, []step{add(0, true), add(2, true), last(1), tick(0, 1, 2), tick()}},
+		{"short stream waits", 3, []step{add(0, true), tick(), tick(), tick(), tick(0)}},
+		{"new stream after running dry", 1, []step{add(5, true), tick(5), tick(), add(0, true), tick(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newJitterBuffer(tt.depth)
+			for i, s := range tt.steps {
+				if !s.tick {
+					if kept := j.add("", 1, s.frame, s.last, []byte{byte(s.frame >> 8), byte(s.frame)}); kept != s.kept {
+						t.Errorf("step %d: adding frame %d kept %t, want %t", i, s.frame, kept, s.kept)
+					}
+					continue
+				}
+				var released []uint16
+				for _, p := range j.tick() {
+					released = append(released, uint16(p.packet[0])<<8|uint16(p.packet[1]))
+				}
+				if fmt.Sprint(released) != fmt.Sprint(s.released) {
+					t.Errorf("step %d: tick released %v, want %v", i, released, s.released)
+				}
+			}
+		})
+	}
+}
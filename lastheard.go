@@ -0,0 +1,155 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// lastHeardSize is how many finished streams are remembered
+const lastHeardSize = 100
+
+// lastHeardSaveInterval is how often the last heard list is saved to disk
+const lastHeardSaveInterval = time.Minute
+
+// heardEntry is a finished stream in the last heard list
+type heardEntry struct {
+	Src       string    `json:"src"`
+	Name      string    `json:"name,omitempty"` // operator name from the roster
+	Dst       string    `json:"dst"`
+	StreamID  uint16    `json:"streamID"`
+	Timestamp time.Time `json:"timestamp"`
+	Duration  float64   `json:"duration"` // seconds
+}
+
+// lastHeard is a ring buffer of recently finished streams
+type lastHeard struct {
+	mu      sync.Mutex
+	entries []heardEntry
+	next    int
+	full    bool
+}
+
+// newLastHeard creates a last heard list holding up to size entries
+func newLastHeard(size int) *lastHeard {
+	return &lastHeard{entries: make([]heardEntry, size)}
+}
+
+// add records a finished stream
+func (l *lastHeard) add(s *stream) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.push(heardEntry{
+		Src:       s.src,
+		Name:      s.name,
+		Dst:       s.dst,
+		StreamID:  s.id,
+		Timestamp: s.started,
+		Duration:  s.lastSeen.Sub(s.started).Seconds(),
+	})
+}
+
+// push appends an entry, overwriting the oldest once full. The caller must
+// hold the lock.
+func (l *lastHeard) push(e heardEntry) {
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent returns up to limit entries, newest first. A limit of zero or less
+// returns every entry.
+func (l *lastHeard) recent(limit int) []heardEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	out := make([]heardEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		idx := (l.next - i + len(l.entries)) % len(l.entries)
+		out = append(out, l.entries[idx])
+	}
+	return out
+}
+
+// save writes the list to path as JSON, newest first. The file is replaced
+// atomically so a crash mid-write leaves the previous copy intact.
+func (l *lastHeard) save(path string) error {
+	data, err := json.Marshal(l.recent(0))
+	if err != nil {
+		return fmt.Errorf("failed to encode last heard list: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save last heard list: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save last heard list: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save last heard list: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save last heard list: %w", err)
+	}
+	return nil
+}
+
+// load adds the entries saved in path, as written by save. A missing file
+// is not an error.
+func (l *lastHeard) load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read last heard list: %w", err)
+	}
+
+	var entries []heardEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse last heard list %s: %w", path, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Saved newest first, so add from the end to keep the order
+	for i := len(entries) - 1; i >= 0; i-- {
+		l.push(entries[i])
+	}
+	return nil
+}
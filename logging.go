@@ -0,0 +1,159 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Log file rotation defaults
+const (
+	DefaultLogFileSize = 100 // megabytes
+	DefaultLogFileKeep = 5
+)
+
+// logLevelNames maps level names to levels
+var logLevelNames = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// parseLogLevel parses a level name such as "info"
+func parseLogLevel(name string) (slog.Level, error) {
+	level, ok := logLevelNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// openLogFile opens path for logging, rotating it once it grows past maxSize
+// megabytes and keeping the newest keep rotated files. If rotate is positive
+// the file is also rotated every rotate hours. Rotation happens under the
+// writer's lock, so records written meanwhile wait rather than being lost.
+func openLogFile(path string, maxSize, keep, rotate int) (*lumberjack.Logger, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid log file size %d MB: must be positive", maxSize)
+	}
+	if keep < 0 {
+		return nil, fmt.Errorf("invalid log file count %d: must not be negative", keep)
+	}
+	if rotate < 0 {
+		return nil, fmt.Errorf("invalid log rotation interval %d hours: must not be negative", rotate)
+	}
+
+	lf := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxSize,
+		MaxBackups: keep,
+		LocalTime:  true,
+	}
+	// Open the file now so a bad path is reported before we start
+	if _, err := lf.Write(nil); err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	if rotate > 0 {
+		go func() {
+			for range time.Tick(time.Duration(rotate) * time.Hour) {
+				if err := lf.Rotate(); err != nil {
+					slog.Error("failed to rotate log file", "path", path, "err", err)
+				}
+			}
+		}()
+	}
+	return lf, nil
+}
+
+// setupLogging installs the default logger with the given level and format.
+// If sample is above one, only every sample-th debug record with the same
+// message is logged.
+func setupLogging(w io.Writer, level slog.Level, format string, sample int) error {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+
+	if sample > 1 {
+		handler = &samplingHandler{Handler: handler, n: uint64(sample), counts: new(sync.Map)}
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// samplingHandler drops all but every nth debug record with the same message,
+// so per-packet debug logging can't hold up decoding on a busy network.
+// Records above debug level always pass.
+type samplingHandler struct {
+	slog.Handler
+	n      uint64
+	counts *sync.Map // message -> *atomic.Uint64, shared with derived handlers
+}
+
+// Handle passes the record on unless it is a debug record being sampled out
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level <= slog.LevelDebug {
+		v, ok := h.counts.Load(r.Message)
+		if !ok {
+			v, _ = h.counts.LoadOrStore(r.Message, new(atomic.Uint64))
+		}
+		if (v.(*atomic.Uint64).Add(1)-1)%h.n != 0 {
+			return nil
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a sampling handler wrapping the handler with attrs added
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), n: h.n, counts: h.counts}
+}
+
+// WithGroup returns a sampling handler wrapping the handler with a group added
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), n: h.n, counts: h.counts}
+}
+
+// debugEnabled reports whether debug messages are logged
+func debugEnabled() bool {
+	return slog.Default().Enabled(context.Background(), slog.LevelDebug)
+}
+
+// hex16 formats a 16-bit field such as a StreamID for logging
+func hex16(v uint16) string {
+	return fmt.Sprintf("0x%04X", v)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package m17
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// base40Chars is the character set used for encoding callsigns
+const (
+	base40Chars = " ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-/."
+)
+
+// MaxCallsignLength is the longest callsign that fits in a 6-byte address
+const MaxCallsignLength = 9
+
+// Reserved M17 addresses
+const (
+	addressInvalid   = 0x000000000000
+	addressMaxBase40 = 0xEE6B27FFFFFF // 40^9 - 1, largest encodable callsign
+	addressBroadcast = 0xFFFFFFFFFFFF
+)
+
+// Labels for reserved addresses
+const (
+	BroadcastCallsign = "@ALL"
+	ReservedCallsign  = "RESERVED"
+)
+
+// EncodeCallsign encodes a callsign into a 6-byte address
+func EncodeCallsign(callsign string) ([]byte, error) {
+	if callsign == "" {
+		return nil, errors.New("empty callsign")
+	}
+	if callsign == BroadcastCallsign {
+		return []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, nil
+	}
+	if len(callsign) > MaxCallsignLength {
+		return nil, fmt.Errorf("callsign %q exceeds %d characters", callsign, MaxCallsignLength)
+	}
+
+	// The first character is the least significant base40 digit
+	address := uint64(0)
+	for i := len(callsign) - 1; i >= 0; i-- {
+		idx := strings.IndexByte(base40Chars, callsign[i])
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid character %q in callsign %q", callsign[i], callsign)
+		}
+		address = address*40 + uint64(idx)
+	}
+
+	encoded := make([]byte, 6)
+	for i := 5; i >= 0; i-- {
+		encoded[i] = byte(address)
+		address >>= 8
+	}
+
+	return encoded, nil
+}
+
+// DecodeCallsign decodes a 6-byte address into a callsign. The M17 spec
+// stores the first character as the least significant base40 digit, so
+// characters come out in reading order as the address is divided down.
+//
+// Space is base40 digit zero, so trailing spaces are the high-order zero
+// digits and decoding stops before them: "KC1AWV  " and "KC1AWV" decode the
+// same. Leading and internal spaces, hyphens, slashes and dots are kept, so
+// a callsign with a module such as "KC1AWV D" decodes intact.
+//
+// The all-zero address decodes to an empty string, the all-ones address to
+// the broadcast label and anything above the base40 range to a reserved label.
+func DecodeCallsign(encoded []byte) string {
+	address := uint64(0)
+
+	for _, b := range encoded {
+		address = address*256 + uint64(b)
+	}
+
+	switch {
+	case address == addressInvalid:
+		return ""
+	case address == addressBroadcast:
+		return BroadcastCallsign
+	case address > addressMaxBase40:
+		return ReservedCallsign
+	}
+
+	callsign := ""
+	for address > 0 {
+		// Least significant digit first, i.e. the leftmost character
+		idx := address % 40
+		callsign += string(base40Chars[idx])
+		address /= 40
+	}
+
+	return callsign
+}
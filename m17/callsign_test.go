@@ -0,0 +1,169 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package m17
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCallsignRoundTrip(t *testing.T) {
+	tests := []string{"A", "AB", "KC1AWV", "KC1AWV D", "M17-XXX A", "N0CALL/P", "W1.AW-9/X", BroadcastCallsign}
+	for _, callsign := range tests {
+		t.Run(callsign, func(t *testing.T) {
+			encoded, err := EncodeCallsign(callsign)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := DecodeCallsign(encoded); got != callsign {
+				t.Errorf("DecodeCallsign(EncodeCallsign(%q)) = %q", callsign, got)
+			}
+		})
+	}
+}
+
+func TestEncodeCallsign(t *testing.T) {
+	tests := []struct {
+		callsign string
+		want     []byte
+	}{
+		{"AB", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x51}},
+		{"KC1AWV", []byte{0x00, 0x00, 0x89, 0xCB, 0x19, 0x83}},
+		{BroadcastCallsign, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	}
+	for _, tt := range tests {
+		got, err := EncodeCallsign(tt.callsign)
+		if err != nil {
+			t.Errorf("EncodeCallsign(%q): %v", tt.callsign, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("EncodeCallsign(%q) = %X, want %X", tt.callsign, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeCallsignInvalid(t *testing.T) {
+	tests := []string{"", "kc1awv", "KC1AWV!", "KC1_AWV", "@BC", "ABCDEFGHIJ"}
+	for _, callsign := range tests {
+		if got, err := EncodeCallsign(callsign); err == nil {
+			t.Errorf("EncodeCallsign(%q) = %X, want an error", callsign, got)
+		}
+	}
+}
+
+func TestEncodeCallsignLength(t *testing.T) {
+	for n := 1; n <= MaxCallsignLength+1; n++ {
+		callsign := strings.Repeat(".", n)
+		encoded, err := EncodeCallsign(callsign)
+		if n > MaxCallsignLength {
+			if err == nil {
+				t.Errorf("EncodeCallsign of %d characters = %X, want an error", n, encoded)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("EncodeCallsign of %d characters: %v", n, err)
+			continue
+		}
+		if got := DecodeCallsign(encoded); got != callsign {
+			t.Errorf("%d characters round-tripped to %q", n, got)
+		}
+	}
+}
+
+func TestDecodeCallsign(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded []byte
+		want    string
+	}{
+		{"reading order", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x51}, "AB"},
+		{"three characters", []byte{0x00, 0x00, 0x00, 0x00, 0x13, 0x11}, "ABC"},
+		{"three characters reversed", []byte{0x00, 0x00, 0x00, 0x00, 0x06, 0x93}, "CBA"},
+		{"callsign", []byte{0x00, 0x00, 0x89, 0xCB, 0x19, 0x83}, "KC1AWV"},
+		{"callsign with digit", []byte{0x00, 0x00, 0x4B, 0x13, 0xD1, 0x06}, "N0CALL"},
+		{"reflector", []byte{0x06, 0x0D, 0x5A, 0xAA, 0x7A, 0xED}, "M17-XXX A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DecodeCallsign(tt.encoded); got != tt.want {
+				t.Errorf("DecodeCallsign(%X) = %q, want %q", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCallsignReserved(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded []byte
+		want    string
+	}{
+		{"all zero", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, ""},
+		{"smallest", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, "A"},
+		{"largest base40", []byte{0xEE, 0x6B, 0x27, 0xFF, 0xFF, 0xFF}, "........."},
+		{"just above base40", []byte{0xEE, 0x6B, 0x28, 0x00, 0x00, 0x00}, ReservedCallsign},
+		{"reserved range", []byte{0xF0, 0x00, 0x00, 0x00, 0x00, 0x00}, ReservedCallsign},
+		{"just below broadcast", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE}, ReservedCallsign},
+		{"broadcast", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, BroadcastCallsign},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DecodeCallsign(tt.encoded); got != tt.want {
+				t.Errorf("DecodeCallsign(%X) = %q, want %q", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallsignSpaces(t *testing.T) {
+	tests := []struct {
+		name     string
+		callsign string
+		same     string // callsign with the same address
+		want     string
+	}{
+		{"plain", "KC1AWV", "KC1AWV", "KC1AWV"},
+		{"module", "KC1AWV D", "KC1AWV D", "KC1AWV D"},
+		{"trailing spaces", "KC1AWV  ", "KC1AWV", "KC1AWV"},
+		{"trailing space after module", "KC1AWV D ", "KC1AWV D", "KC1AWV D"},
+		{"leading space", " KC1AWV", " KC1AWV", " KC1AWV"},
+		{"internal spaces", "KC1  AWV", "KC1  AWV", "KC1  AWV"},
+		{"only spaces", "   ", "   ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := EncodeCallsign(tt.callsign)
+			if err != nil {
+				t.Fatal(err)
+			}
+			same, err := EncodeCallsign(tt.same)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encoded, same) {
+				t.Errorf("EncodeCallsign(%q) = %X, want %X as for %q", tt.callsign, encoded, same, tt.same)
+			}
+			if got := DecodeCallsign(encoded); got != tt.want {
+				t.Errorf("DecodeCallsign(EncodeCallsign(%q)) = %q, want %q", tt.callsign, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package m17
+
+import "testing"
+
+func TestCRC(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+
+	// Test vectors from the M17 specification
+	tests := []struct {
+		name string
+		data []byte
+		want uint16
+	}{
+		{"empty", nil, 0xFFFF},
+		{"A", []byte("A"), 0x206E},
+		{"123456789", []byte("123456789"), 0x772B},
+		{"0x00 to 0xFF", all, 0x1C31},
+	}
+	for _, tt := range tests {
+		if got := CRC(tt.data); got != tt.want {
+			t.Errorf("CRC(%s) = 0x%04X, want 0x%04X", tt.name, got, tt.want)
+		}
+	}
+}
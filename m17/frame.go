@@ -0,0 +1,103 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package m17 parses the M17 frames carried over IP between reflectors,
+// gateways and clients: stream frames, packet mode datagrams, the Link Setup
+// Frame they carry and its base40 callsigns.
+package m17
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Packet MAGIC constants
+const (
+	MagicStream = "M17 "
+	MagicPacket = "M17P"
+)
+
+// StreamFrameSize is the size of an M17 IP stream frame: MAGIC (4),
+// StreamID (2), LICH (28), frame number (2), payload (16) and CRC (2)
+const StreamFrameSize = 54
+
+// PayloadSize is the size of a stream frame payload
+const PayloadSize = 16
+
+// Frame number fields
+const (
+	LastFrameFlag   = 0x8000 // set on the final frame of a transmission
+	FrameNumberMask = 0x7FFF
+)
+
+// Stream frame errors
+var (
+	ErrFrameSize = errors.New("invalid stream frame size")
+	ErrCRC       = errors.New("stream frame CRC mismatch")
+)
+
+// StreamFrame is a parsed M17 IP stream frame. Its LSF META and Payload share
+// memory with the bytes it was parsed from.
+type StreamFrame struct {
+	StreamID    uint16
+	LSF         LSF
+	FrameNumber uint16 // without the last frame flag
+	Last        bool   // the final frame of the transmission
+	Payload     []byte
+}
+
+// CheckStreamFrame checks the size of a stream frame and the CRC over
+// everything before it. Errors wrap ErrFrameSize or ErrCRC.
+func CheckStreamFrame(frame []byte) error {
+	if len(frame) != StreamFrameSize {
+		return fmt.Errorf("%w: %d bytes, want %d", ErrFrameSize, len(frame), StreamFrameSize)
+	}
+	if crc, want := binary.BigEndian.Uint16(frame[52:54]), CRC(frame[:52]); crc != want {
+		return fmt.Errorf("%w: got 0x%04X, want 0x%04X", ErrCRC, crc, want)
+	}
+	return nil
+}
+
+// DecodeStreamFrame splits a stream frame into its fields without checking
+// the CRC, for frames already checked with CheckStreamFrame
+func DecodeStreamFrame(frame []byte) (StreamFrame, error) {
+	if len(frame) != StreamFrameSize {
+		return StreamFrame{}, fmt.Errorf("%w: %d bytes, want %d", ErrFrameSize, len(frame), StreamFrameSize)
+	}
+
+	lsf, err := ParseLSF(frame[6:34])
+	if err != nil {
+		return StreamFrame{}, err
+	}
+	frameNumber := binary.BigEndian.Uint16(frame[34:36])
+	return StreamFrame{
+		StreamID:    binary.BigEndian.Uint16(frame[4:6]),
+		LSF:         lsf,
+		FrameNumber: frameNumber & FrameNumberMask,
+		Last:        frameNumber&LastFrameFlag != 0,
+		Payload:     frame[36 : 36+PayloadSize],
+	}, nil
+}
+
+// ParseStreamFrame checks and decodes a stream frame
+func ParseStreamFrame(frame []byte) (StreamFrame, error) {
+	if err := CheckStreamFrame(frame); err != nil {
+		return StreamFrame{}, err
+	}
+	return DecodeStreamFrame(frame)
+}
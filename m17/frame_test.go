@@ -0,0 +1,108 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package m17
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// makeStreamFrame builds a stream frame with a valid CRC
+func makeStreamFrame(t *testing.T, id uint16, dst, src string, typ uint16, frameNumber uint16, payload []byte) []byte {
+	t.Helper()
+	frame := make([]byte, StreamFrameSize)
+	copy(frame, MagicStream)
+	binary.BigEndian.PutUint16(frame[4:], id)
+	copy(frame[6:], makeLSF(t, dst, src, typ, nil)[:LSDSize])
+	binary.BigEndian.PutUint16(frame[34:], frameNumber)
+	copy(frame[36:], payload)
+	binary.BigEndian.PutUint16(frame[52:], CRC(frame[:52]))
+	return frame
+}
+
+func TestCheckStreamFrame(t *testing.T) {
+	good := makeStreamFrame(t, 0x1234, "M17-XXX A", "KC1AWV", 0x0005, 0, []byte("sixteen bytes!!!"))
+	corrupt := func(i int) []byte {
+		frame := append([]byte(nil), good...)
+		frame[i] ^= 0x01
+		return frame
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  error
+	}{
+		{"good", good, nil},
+		{"corrupt StreamID", corrupt(4), ErrCRC},
+		{"corrupt LSF", corrupt(12), ErrCRC},
+		{"corrupt payload", corrupt(40), ErrCRC},
+		{"corrupt CRC", corrupt(53), ErrCRC},
+		{"short", good[:StreamFrameSize-1], ErrFrameSize},
+		{"long", append(append([]byte(nil), good...), 0), ErrFrameSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckStreamFrame(tt.frame)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("CheckStreamFrame = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStreamFrame(t *testing.T) {
+	payload := []byte("sixteen bytes!!!")
+	tests := []struct {
+		name        string
+		frameNumber uint16
+		wantNumber  uint16
+		wantLast    bool
+	}{
+		{"first", 0, 0, false},
+		{"middle", 0x0123, 0x0123, false},
+		{"largest", 0x7FFF, 0x7FFF, false},
+		{"last", 0x8005, 5, true},
+		{"last at the wrap", 0xFFFF, 0x7FFF, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseStreamFrame(makeStreamFrame(t, 0xBEEF, "M17-XXX A", "KC1AWV", 0x0805, tt.frameNumber, payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.StreamID != 0xBEEF || f.FrameNumber != tt.wantNumber || f.Last != tt.wantLast || string(f.Payload) != string(payload) {
+				t.Errorf("ParseStreamFrame = StreamID 0x%04X frame %d last %t payload %q, want 0xBEEF, %d, %t, %q",
+					f.StreamID, f.FrameNumber, f.Last, f.Payload, tt.wantNumber, tt.wantLast, payload)
+			}
+			if f.LSF.Dst != "M17-XXX A" || f.LSF.Src != "KC1AWV" || f.LSF.Type != 0x0805 || len(f.LSF.Meta) != 14 {
+				t.Errorf("ParseStreamFrame LSF = %+v", f.LSF)
+			}
+		})
+	}
+
+	frame := makeStreamFrame(t, 0xBEEF, "M17-XXX A", "KC1AWV", 0x0005, 0, payload)
+	frame[40] ^= 0x01
+	if _, err := ParseStreamFrame(frame); !errors.Is(err, ErrCRC) {
+		t.Errorf("ParseStreamFrame of a corrupt frame: %v, want ErrCRC", err)
+	}
+	if _, err := DecodeStreamFrame(frame); err != nil {
+		t.Errorf("DecodeStreamFrame of a corrupt frame: %v, want no CRC check", err)
+	}
+}
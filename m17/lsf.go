@@ -0,0 +1,154 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package m17
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LSF sizes
+const (
+	LSDSize = 28          // DST, SRC, TYPE and META as carried in IP frames
+	LSFSize = LSDSize + 2 // the above plus the LSF CRC
+)
+
+// LSF is a parsed M17 Link Setup Frame
+type LSF struct {
+	Dst  string
+	Src  string
+	Type uint16
+	Meta []byte
+}
+
+// IsEmpty reports whether the LSF is all zero, carrying no link setup at all
+func (l LSF) IsEmpty() bool {
+	if l.Type != 0 || l.Dst != "" || l.Src != "" {
+		return false
+	}
+	for _, b := range l.Meta {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsStream reports whether the LSF describes stream mode rather than packet mode
+func (l LSF) IsStream() bool {
+	return l.Type&0x0001 != 0
+}
+
+// DataType returns the data type indicator (voice, data or both)
+func (l LSF) DataType() uint16 {
+	return (l.Type >> 1) & 0x0003
+}
+
+// EncryptionType returns the encryption type
+func (l LSF) EncryptionType() uint16 {
+	return (l.Type >> 3) & 0x0003
+}
+
+// EncryptionSubtype returns the encryption subtype
+func (l LSF) EncryptionSubtype() uint16 {
+	return (l.Type >> 5) & 0x0003
+}
+
+// Data types
+const (
+	DataTypeData      = 0b01
+	DataTypeVoice     = 0b10
+	DataTypeVoiceData = 0b11 // Codec 2 1600 voice alongside 8 bytes of data
+)
+
+// dataTypeNames maps data type indicators to their names
+var dataTypeNames = [4]string{"Reserved", "Data", "Voice", "Voice+Data"}
+
+// DataTypeName returns the name of the data type indicator
+func (l LSF) DataTypeName() string {
+	return dataTypeNames[l.DataType()]
+}
+
+// Encryption types
+const (
+	EncryptionNone      = 0b00
+	EncryptionScrambler = 0b01
+	EncryptionAES       = 0b10
+)
+
+// encryptionNames maps encryption types to their names
+var encryptionNames = map[uint16]string{
+	EncryptionNone:      "None",
+	EncryptionScrambler: "Scrambler",
+	EncryptionAES:       "AES",
+	0b11:                "Reserved",
+}
+
+// encryptionSubtypeNames maps the subtype of each encryption type to its meaning.
+// Unencrypted streams use the subtype to describe the META field instead.
+var encryptionSubtypeNames = map[uint16][4]string{
+	EncryptionNone:      {"Text", "GNSS", "Extended Callsign", "Reserved"},
+	EncryptionScrambler: {"8-bit", "16-bit", "24-bit", "Reserved"},
+	EncryptionAES:       {"AES-128", "AES-192", "AES-256", "Reserved"},
+	0b11:                {"Reserved", "Reserved", "Reserved", "Reserved"},
+}
+
+// EncryptionName returns the name of the encryption type
+func (l LSF) EncryptionName() string {
+	return encryptionNames[l.EncryptionType()]
+}
+
+// EncryptionSubtypeName returns the meaning of the encryption subtype
+func (l LSF) EncryptionSubtypeName() string {
+	return encryptionSubtypeNames[l.EncryptionType()][l.EncryptionSubtype()]
+}
+
+// ChannelAccessNumber returns the channel access number
+func (l LSF) ChannelAccessNumber() uint16 {
+	return (l.Type >> 7) & 0x000F
+}
+
+// TypeReservedMask covers the TYPE bits the spec leaves reserved
+const TypeReservedMask = 0xF800
+
+// Reserved returns the reserved TYPE bits in place. Current senders leave
+// them zero, so any set bits come from a newer or nonconforming sender.
+func (l LSF) Reserved() uint16 {
+	return l.Type & TypeReservedMask
+}
+
+// ParseLSF parses an LSF. IP stream frames carry the 28 bytes without a CRC;
+// a full 30-byte LSF also has its CRC checked.
+func ParseLSF(lich []byte) (LSF, error) {
+	switch len(lich) {
+	case LSDSize:
+	case LSFSize:
+		if crc := binary.BigEndian.Uint16(lich[LSDSize:]); crc != CRC(lich[:LSDSize]) {
+			return LSF{}, fmt.Errorf("LSF CRC mismatch: got 0x%04X, want 0x%04X", crc, CRC(lich[:LSDSize]))
+		}
+	default:
+		return LSF{}, fmt.Errorf("invalid LSF length %d", len(lich))
+	}
+
+	return LSF{
+		Dst:  DecodeCallsign(lich[0:6]),
+		Src:  DecodeCallsign(lich[6:12]),
+		Type: binary.BigEndian.Uint16(lich[12:14]),
+		Meta: lich[14:28],
+	}, nil
+}
@@ -0,0 +1,182 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package m17
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// makeLSF builds a 30-byte LSF with a valid CRC
+func makeLSF(t *testing.T, dst, src string, typ uint16, meta []byte) []byte {
+	t.Helper()
+	lsf := make([]byte, LSFSize)
+	d, err := EncodeCallsign(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := EncodeCallsign(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(lsf[0:], d)
+	copy(lsf[6:], s)
+	binary.BigEndian.PutUint16(lsf[12:], typ)
+	copy(lsf[14:LSDSize], meta)
+	binary.BigEndian.PutUint16(lsf[LSDSize:], CRC(lsf[:LSDSize]))
+	return lsf
+}
+
+func TestParseLSF(t *testing.T) {
+	meta := []byte("\x00hello")
+	good := makeLSF(t, "M17-XXX A", "KC1AWV", 0x0005, meta)
+	bad := append([]byte(nil), good...)
+	bad[LSFSize-1] ^= 0x01
+
+	tests := []struct {
+		name    string
+		lich    []byte
+		wantErr bool
+	}{
+		{"LSD without CRC", good[:LSDSize], false},
+		{"LSF with good CRC", good, false},
+		{"LSF with bad CRC", bad, true},
+		{"one byte short", good[:LSDSize-1], true},
+		{"between sizes", good[:LSDSize+1], true},
+		{"one byte long", append(append([]byte(nil), good...), 0), true},
+		{"empty", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lsf, err := ParseLSF(tt.lich)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseLSF = %+v, want an error", lsf)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lsf.Dst != "M17-XXX A" || lsf.Src != "KC1AWV" || lsf.Type != 0x0005 {
+				t.Errorf("ParseLSF = dst %q src %q type 0x%04X, want M17-XXX A, KC1AWV, 0x0005", lsf.Dst, lsf.Src, lsf.Type)
+			}
+			if want := append(meta, make([]byte, 14-len(meta))...); !bytes.Equal(lsf.Meta, want) {
+				t.Errorf("ParseLSF meta = %X, want %X", lsf.Meta, want)
+			}
+		})
+	}
+}
+
+func TestLSFType(t *testing.T) {
+	tests := []struct {
+		stream                bool
+		dataType, encType     uint16
+		encSubtype, canNumber uint16
+	}{
+		{true, 0b10, 0, 0, 0},
+		{true, 0b11, 0, 0, 15},
+		{false, 0b01, 0, 0, 0},
+		{true, 0b10, 0b10, 0b01, 3},
+		{true, 0b10, 0b01, 0b11, 9},
+	}
+	for _, tt := range tests {
+		typ := tt.dataType<<1 | tt.encType<<3 | tt.encSubtype<<5 | tt.canNumber<<7
+		if tt.stream {
+			typ |= 1
+		}
+		l := LSF{Type: typ}
+		if l.IsStream() != tt.stream || l.DataType() != tt.dataType || l.EncryptionType() != tt.encType ||
+			l.EncryptionSubtype() != tt.encSubtype || l.ChannelAccessNumber() != tt.canNumber {
+			t.Errorf("TYPE 0x%04X = stream %t, data type %d, encryption %d/%d, CAN %d", typ,
+				l.IsStream(), l.DataType(), l.EncryptionType(), l.EncryptionSubtype(), l.ChannelAccessNumber())
+		}
+	}
+}
+
+func TestEncryptionNames(t *testing.T) {
+	want := [4]struct {
+		name     string
+		subtypes [4]string
+	}{
+		{"None", [4]string{"Text", "GNSS", "Extended Callsign", "Reserved"}},
+		{"Scrambler", [4]string{"8-bit", "16-bit", "24-bit", "Reserved"}},
+		{"AES", [4]string{"AES-128", "AES-192", "AES-256", "Reserved"}},
+		{"Reserved", [4]string{"Reserved", "Reserved", "Reserved", "Reserved"}},
+	}
+	for typ := uint16(0); typ < 4; typ++ {
+		for subtype := uint16(0); subtype < 4; subtype++ {
+			lsf := LSF{Type: 0x0005 | typ<<3 | subtype<<5}
+			if lsf.EncryptionType() != typ || lsf.EncryptionSubtype() != subtype {
+				t.Errorf("TYPE 0x%04X has encryption %d subtype %d, want %d and %d",
+					lsf.Type, lsf.EncryptionType(), lsf.EncryptionSubtype(), typ, subtype)
+			}
+			if got := lsf.EncryptionName(); got != want[typ].name {
+				t.Errorf("encryption %d is named %q, want %q", typ, got, want[typ].name)
+			}
+			if got := lsf.EncryptionSubtypeName(); got != want[typ].subtypes[subtype] {
+				t.Errorf("encryption %d subtype %d is named %q, want %q", typ, subtype, got, want[typ].subtypes[subtype])
+			}
+		}
+	}
+}
+
+func TestDataTypeName(t *testing.T) {
+	tests := []struct {
+		typ  uint16
+		want string
+	}{
+		{0x0001, "Reserved"},
+		{0x0003, "Data"},
+		{0x0005, "Voice"},
+		{0x0007, "Voice+Data"},
+	}
+	for _, tt := range tests {
+		if got := (LSF{Type: tt.typ}).DataTypeName(); got != tt.want {
+			t.Errorf("TYPE 0x%04X data type is named %q, want %q", tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestParseLSFReserved(t *testing.T) {
+	tests := []struct {
+		typ  uint16
+		want uint16
+	}{
+		{0x0005, 0},
+		{0x0805, 0x0800},
+		{0xF805, 0xF800},
+		{0xFFFF, 0xF800},
+	}
+	for _, tt := range tests {
+		for _, n := range []int{LSDSize, LSFSize} {
+			lsf, err := ParseLSF(makeLSF(t, "M17-XXX A", "KC1AWV", tt.typ, nil)[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lsf.Type != tt.typ || lsf.Reserved() != tt.want {
+				t.Errorf("ParseLSF of %d bytes with TYPE 0x%04X = TYPE 0x%04X reserved 0x%04X, want reserved 0x%04X",
+					n, tt.typ, lsf.Type, lsf.Reserved(), tt.want)
+			}
+			if lsf.DataType() != tt.typ>>1&0x0003 || lsf.ChannelAccessNumber() != tt.typ>>7&0x000F {
+				t.Errorf("reserved bits leak into the fields of TYPE 0x%04X", tt.typ)
+			}
+		}
+	}
+}
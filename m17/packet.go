@@ -0,0 +1,90 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package m17
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Packet mode sizes. Over IP a whole packet arrives in one datagram: MAGIC
+// (4), the LSF with its CRC (30) and the packet data, which is a content
+// type byte, the content and a CRC.
+const (
+	PacketHeaderSize  = 4 + LSFSize
+	MaxPacketDataSize = 825
+)
+
+// Packet content types
+const (
+	PacketRaw     = 0x00
+	PacketAX25    = 0x01
+	PacketAPRS    = 0x02
+	Packet6LoWPAN = 0x03
+	PacketIPv4    = 0x04
+	PacketSMS     = 0x05
+	PacketWinlink = 0x06
+)
+
+// packetTypeNames maps packet content types to their names
+var packetTypeNames = map[byte]string{
+	PacketRaw:     "RAW",
+	PacketAX25:    "AX.25",
+	PacketAPRS:    "APRS",
+	Packet6LoWPAN: "6LoWPAN",
+	PacketIPv4:    "IPv4",
+	PacketSMS:     "SMS",
+	PacketWinlink: "Winlink",
+}
+
+// PacketTypeName returns the name of a packet content type
+func PacketTypeName(typ byte) string {
+	if name, ok := packetTypeNames[typ]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02X", typ)
+}
+
+// ParsePacketData checks the CRC of packet mode data and splits it into its
+// content type and content
+func ParsePacketData(data []byte) (byte, []byte, error) {
+	if len(data) < 3 {
+		return 0, nil, fmt.Errorf("packet data too short: %d bytes", len(data))
+	}
+	if len(data) > MaxPacketDataSize {
+		return 0, nil, fmt.Errorf("packet data too long: %d bytes", len(data))
+	}
+
+	n := len(data) - 2
+	if crc := binary.BigEndian.Uint16(data[n:]); crc != CRC(data[:n]) {
+		return 0, nil, fmt.Errorf("packet CRC mismatch: got 0x%04X, want 0x%04X", crc, CRC(data[:n]))
+	}
+	return data[0], data[1:n], nil
+}
+
+// SMSText extracts the text of an SMS packet, which may be NUL terminated
+func SMSText(content []byte) (string, error) {
+	text, _, _ := strings.Cut(string(content), "\x00")
+	if !utf8.ValidString(text) {
+		return "", errors.New("SMS text is not valid UTF-8")
+	}
+	return text, nil
+}
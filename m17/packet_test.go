@@ -0,0 +1,69 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package m17
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// makePacketData builds packet data with a valid CRC
+func makePacketData(typ byte, content []byte) []byte {
+	data := append([]byte{typ}, content...)
+	return binary.BigEndian.AppendUint16(data, CRC(data))
+}
+
+func TestParsePacketData(t *testing.T) {
+	sms := makePacketData(PacketSMS, []byte("hello\x00"))
+	bad := append([]byte(nil), sms...)
+	bad[1] ^= 0x01
+
+	tests := []struct {
+		name        string
+		data        []byte
+		wantType    byte
+		wantContent []byte
+		wantErr     bool
+	}{
+		{"SMS", sms, PacketSMS, []byte("hello\x00"), false},
+		{"no content", makePacketData(PacketRaw, nil), PacketRaw, []byte{}, false},
+		{"largest", makePacketData(PacketRaw, make([]byte, MaxPacketDataSize-3)), PacketRaw, make([]byte, MaxPacketDataSize-3), false},
+		{"bad CRC", bad, 0, nil, true},
+		{"empty", nil, 0, nil, true},
+		{"two bytes", sms[:2], 0, nil, true},
+		{"too long", makePacketData(PacketRaw, make([]byte, MaxPacketDataSize-2)), 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typ, content, err := ParsePacketData(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParsePacketData = %d, %X, want an error", typ, content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typ != tt.wantType || !bytes.Equal(content, tt.wantContent) {
+				t.Errorf("ParsePacketData = %d, %X, want %d, %X", typ, content, tt.wantType, tt.wantContent)
+			}
+		})
+	}
+}
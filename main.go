@@ -19,46 +19,202 @@ package main
 
 import (
 	"flag"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 )
 
-var debug bool
+var (
+	debug        bool
+	showVersion  bool
+	selfTest     bool
+	pcapFile     string
+	configFile   string
+	logLevelName string
+	logFormat    string
+	logSample    int
+	logFile      string
+	logFileSize  int
+	logFileKeep  int
+	logRotate    int
+	cfg          Config
+)
 
 func init() {
-	flag.BoolVar(&debug, "debug", false, "enable debug logging")
+	flag.BoolVar(&showVersion, "version", false, "print version information and exit")
+	flag.BoolVar(&selfTest, "selftest", false, "run a loopback test of the decode pipeline, print PASS or FAIL and exit")
+	flag.BoolVar(&debug, "debug", false, "enable debug logging (same as -loglevel debug)")
+	flag.StringVar(&logLevelName, "loglevel", "info", "minimum log level: debug, info, warn or error")
+	flag.StringVar(&logFormat, "logformat", "text", "log format: text or json")
+	flag.IntVar(&logSample, "logsample", 0, "log only every Nth debug message of each kind, so busy streams don't slow decoding; 0 or 1 logs all")
+	flag.StringVar(&logFile, "logfile", "", "write logs to this file instead of the terminal, rotating it by size")
+	flag.IntVar(&logFileSize, "logfile-size", DefaultLogFileSize, "rotate -logfile once it reaches this many megabytes")
+	flag.IntVar(&logFileKeep, "logfile-keep", DefaultLogFileKeep, "number of rotated -logfile files to keep, 0 to keep all")
+	flag.IntVar(&logRotate, "logfile-rotate", 0, "also rotate -logfile every this many hours, e.g. 24; 0 rotates by size only")
+	flag.StringVar(&configFile, "config", "", "load settings from a JSON config file; flags override file values")
+	flag.StringVar(&cfg.Interface, "iface", "lo", "network interface to capture on, or any for all interfaces on Linux")
+	flag.StringVar(&cfg.Ports, "port", strconv.Itoa(DefaultPort), "UDP ports carrying M17 traffic, as a comma-separated list or ranges (e.g. 17010,17020-17029)")
+	flag.IntVar(&cfg.Retry, "retry", 0, "retry opening the interface this many times with backoff before giving up")
+	flag.IntVar(&cfg.Snaplen, "snaplen", DefaultSnaplen, "capture snapshot length in bytes")
+	flag.BoolVar(&cfg.Promisc, "promisc", true, "capture in promiscuous mode; use -promisc=false to see only traffic for this host")
+	flag.StringVar(&cfg.BPF, "bpf", "", "extra BPF filter ANDed with the port filter, e.g. \"host 192.0.2.1\"")
+	flag.BoolVar(&cfg.BPFReplace, "bpf-replace", false, "use the -bpf filter instead of the port filter")
+	flag.StringVar(&cfg.Listen, "listen", "", "receive M17 datagrams on this UDP address, e.g. :17010, instead of capturing; needs no root")
+	flag.StringVar(&pcapFile, "pcap", "", "replay packets from a capture file instead of a live interface")
+	flag.StringVar(&cfg.Connect, "connect", "", "connect to a reflector at host:port or [ipv6]:port instead of capturing traffic")
+	flag.StringVar(&cfg.Module, "module", "A", "reflector module to link to with -connect")
+	flag.StringVar(&cfg.Callsign, "callsign", "", "our callsign when linking to a reflector with -connect")
+	flag.IntVar(&cfg.PingTimeout, "ping-timeout", DefaultPingTimeout, "seconds without a PING or other packet from the reflector before relinking")
+	flag.BoolVar(&cfg.JSON, "json", false, "emit stream start/end events as JSON lines on stdout")
+	flag.IntVar(&cfg.Stats, "stats", 0, "log packets captured, frames decoded and active streams every this many seconds; 0 disables")
+	flag.IntVar(&cfg.Heartbeat, "heartbeat", DefaultHeartbeat, "seconds between heartbeat events carrying uptime and active streams, 0 to disable")
+	flag.BoolVar(&cfg.TUI, "tui", false, "show live activity and last heard stations in a full-screen terminal view; logs are discarded")
+	flag.BoolVar(&cfg.Dump, "dump", false, "print a hex dump and the decoded fields of each M17 packet instead of playing audio")
+	flag.BoolVar(&cfg.Packets, "packets", false, "decode M17 packet mode data such as SMS messages")
+	flag.StringVar(&cfg.DBPath, "db", "", "log every finished transmission to this SQLite database, created if missing")
+	flag.StringVar(&cfg.Roster, "roster", "", "CSV file of callsign,name rows used to show operator names; reloaded on SIGHUP")
+	flag.StringVar(&cfg.HeardFile, "heard-file", "", "save the last heard list to this JSON file and reload it on startup")
+	flag.StringVar(&cfg.RecordDir, "record", "", "record each transmission to a WAV file in this directory")
+	flag.BoolVar(&cfg.FillGaps, "fill-gaps", false, "insert silence for frames lost from a stream")
+	flag.IntVar(&cfg.StreamTimeout, "stream-timeout", DefaultStreamTimeout, "milliseconds without frames before a stream lacking an end-of-stream frame is considered ended; too short splits transmissions")
+	flag.IntVar(&cfg.Jitter, "jitter", 0, "buffer this many frames (40 ms each) per stream to put late frames back in order, e.g. 3; 0 disables")
+	flag.IntVar(&cfg.Dedup, "dedup", 0, "skip frames repeated within this many milliseconds, e.g. echoes from a reflector loop; 0 disables")
+	flag.StringVar(&cfg.PCMOut, "pcmout", "", "also write raw 8 kHz 16-bit PCM to a file, named pipe or - for stdout")
+	flag.StringVar(&cfg.PCMEndian, "pcm-endian", "little", "byte order of -pcmout samples: little or big; the audio device is always fed little-endian, the only order oto accepts")
+	flag.StringVar(&cfg.OpusOut, "opusout", "", "also write Opus packets at -samplerate, each prefixed by a 16-bit big-endian length, to a file, named pipe or - for stdout")
+	flag.IntVar(&cfg.OpusBitrate, "opus-bitrate", DefaultOpusBitrate, "Opus bitrate in bits per second")
+	flag.StringVar(&cfg.DstAllow, "dst", "", "only monitor these comma-separated destinations (default all)")
+	flag.StringVar(&cfg.DstDeny, "dst-deny", "", "ignore these comma-separated destinations")
+	flag.StringVar(&cfg.SrcAllow, "src-allow", "", "only monitor these comma-separated source callsigns (default all)")
+	flag.StringVar(&cfg.SrcDeny, "src-deny", "", "ignore these comma-separated source callsigns, even if allowed")
+	flag.StringVar(&cfg.NotifySrc, "notify-src", "", "beep, and show a desktop notification via notify-send where available, when any of these comma-separated callsigns starts transmitting")
+	flag.StringVar(&cfg.AESKey, "aeskey", "", "hex AES-128/192/256 key for decrypting AES encrypted streams")
+	flag.StringVar(&cfg.ScrambleKey, "scramble-key", "", "hex 8, 16 or 24-bit seed for descrambling scrambled streams")
+	flag.StringVar(&cfg.MetricsAddr, "metrics", "", "serve Prometheus metrics on this address, e.g. :9108")
+	flag.StringVar(&cfg.WebAddr, "web", "", "serve a live web page of stream events on this address, e.g. :8080")
+	flag.StringVar(&cfg.APIAddr, "api", "", "serve the REST API (/api/lastheard, /status, POST /pause and /resume) on this address, e.g. :8081")
+	flag.StringVar(&cfg.StreamAddr, "stream", "", "serve decoded audio as a continuous WAV stream over HTTP on this address, e.g. :8000")
+	flag.StringVar(&cfg.MQTTBroker, "mqtt", "", "publish stream events to this MQTT broker, e.g. broker:1883")
+	flag.StringVar(&cfg.MQTTTopic, "topic", "m17/events", "MQTT topic for stream events")
+	flag.StringVar(&cfg.APRSServer, "aprs-server", "", "forward stream GNSS positions to this APRS-IS server, e.g. rotate.aprs2.net:14580")
+	flag.StringVar(&cfg.APRSCall, "aprs-call", "", "our callsign for logging in to APRS-IS")
+	flag.StringVar(&cfg.APRSPass, "aprs-pass", "", "APRS-IS passcode for -aprs-call")
+	flag.IntVar(&cfg.APRSInterval, "aprs-interval", DefaultAPRSInterval, "minimum seconds between APRS-IS beacons for one station")
+	flag.BoolVar(&cfg.NoSound, "nosound", false, "run headless without opening an audio device")
+	flag.IntVar(&cfg.SampleRate, "samplerate", codec2SampleRate, "audio output sample rate in Hz, resampled from 8 kHz if different")
+	flag.IntVar(&cfg.SampleRate, "outrate", codec2SampleRate, "alias for -samplerate")
+	flag.StringVar(&cfg.AudioDevice, "audiodev", "", "play through this PulseAudio or PipeWire sink (see pactl list short sinks) instead of the default; sets PULSE_SINK, Linux only")
+	flag.IntVar(&cfg.Channels, "channels", 1, "audio output channels: 1 for mono, or 2 to duplicate each sample to left and right for devices that misbehave with mono")
+	flag.IntVar(&cfg.AudioBuffer, "audiobuf", DefaultAudioBuffer, "audio output buffer size in bytes")
+	flag.Float64Var(&cfg.Gain, "gain", 1.0, "playback volume multiplier, clipped to the sample range")
+	flag.BoolVar(&cfg.HighPass, "hpf", false, "high-pass filter decoded audio at 100 Hz to remove DC offset")
+	flag.IntVar(&cfg.Silence, "silence", DefaultSilence, "milliseconds of silence played between transmissions, 0 to disable")
+	flag.BoolVar(&cfg.Levels, "levels", false, "log the RMS and peak level of each decoded 20 ms frame")
 }
 
 // main is the entry point of the program
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nAny flag can also be set with an environment variable named after it,\ne.g. %s for -iface or %s for -fill-gaps. Flags take precedence.\n", envName("iface"), envName("fill-gaps"))
+	}
 	flag.Parse()
 
+	if showVersion {
+		fmt.Println(versionString())
+		return
+	}
+
+	if err := resolveConfig(flag.CommandLine, &cfg, os.LookupEnv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	level, err := parseLogLevel(logLevelName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var logOutput io.Writer = os.Stderr
 	if debug {
-		// Enable logging to stdout for debugging
-		log.SetOutput(os.Stdout)
-	} else {
-		// Disable logging
-		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		level = slog.LevelDebug
+		if !cfg.JSON && cfg.PCMOut != "-" && cfg.OpusOut != "-" {
+			// Log to stdout for debugging unless it carries events or audio
+			logOutput = os.Stdout
+		}
+	}
+	if cfg.TUI {
+		// Log lines would scribble over the terminal view
+		logOutput = io.Discard
+	}
+	if logFile != "" {
+		lf, err := openLogFile(logFile, logFileSize, logFileKeep, logRotate)
 		if err != nil {
-			log.Fatalf("failed to open %s: %v", os.DevNull, err)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer lf.Close()
+		logOutput = lf
+	}
+	if err := setupLogging(logOutput, level, logFormat, logSample); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if selfTest {
+		if err := runSelfTest(); err != nil {
+			fmt.Println("FAIL:", err)
+			os.Exit(1)
 		}
-		defer devNull.Close()
-		log.SetOutput(devNull)
+		fmt.Println("PASS")
+		return
 	}
 
 	// Create a new client and start listening for packets
-	client, err := NewClient("lo") // "lo" is the loopback interface on Linux
+	var client *Client
+	switch {
+	case cfg.Connect != "":
+		client, err = NewClientFromReflector(cfg)
+	case cfg.Listen != "":
+		client, err = NewClientFromSocket(cfg)
+	case pcapFile != "":
+		client, err = NewClientFromFile(pcapFile, cfg)
+	default:
+		client, err = NewClient(cfg)
+	}
 	if err != nil {
-		log.Fatalf("failed to create client: %v", err)
+		fmt.Fprintf(os.Stderr, "failed to create client: %v\n", err)
+		os.Exit(1)
 	}
-	go client.listen()
+	client.start()
+
+	// Log active streams on SIGUSR1 and reload the roster on SIGHUP
+	dumpChan := make(chan os.Signal, 1)
+	signal.Notify(dumpChan, syscall.SIGUSR1)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 
-	// Wait for SIGINT or SIGTERM to shutdown the client
+	// Wait for SIGINT or SIGTERM, or for a capture file to run out
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-	log.Println("Shutting down client...")
-	client.cancel()
+wait:
+	for {
+		select {
+		case <-dumpChan:
+			client.logStreams()
+		case <-hupChan:
+			client.reloadRoster()
+		case <-sigChan:
+			break wait
+		case <-client.ctx.Done():
+			break wait
+		}
+	}
+	slog.Info("shutting down client")
+	client.Close()
 }
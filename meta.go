@@ -0,0 +1,266 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// META contents for unencrypted streams, selected by the encryption subtype
+const (
+	metaText             = 0b00
+	metaGNSS             = 0b01
+	metaExtendedCallsign = 0b10
+)
+
+// metaInfo holds the decoded contents of the META field
+type metaInfo struct {
+	kind      string
+	text      string   // text fragment carried in this frame
+	block     int      // index of the text block, from 0
+	blocks    int      // number of text blocks in the whole message
+	position  Position // GNSS position
+	callsign1 string   // extended callsign data
+	callsign2 string
+}
+
+// String formats the metadata for logging
+func (m metaInfo) String() string {
+	switch m.kind {
+	case "text":
+		return fmt.Sprintf("text=%q block=%d/%d", m.text, m.block+1, m.blocks)
+	case "gnss":
+		return m.position.String()
+	case "extended callsign":
+		return fmt.Sprintf("callsign1=%s callsign2=%s", m.callsign1, m.callsign2)
+	}
+	return m.kind
+}
+
+// parseMeta decodes the META field according to the LSF TYPE. It returns
+// false when the field is empty or carries nothing we understand.
+func parseMeta(lsf m17.LSF) (metaInfo, bool) {
+	meta := lsf.Meta
+	if len(meta) != 14 || isZero(meta) {
+		return metaInfo{}, false
+	}
+
+	// Encrypted streams use META for the IV or scrambler seed
+	if lsf.EncryptionType() != m17.EncryptionNone {
+		return metaInfo{}, false
+	}
+
+	switch lsf.EncryptionSubtype() {
+	case metaText:
+		block, blocks := textControl(meta[0])
+		return metaInfo{kind: "text", text: cleanText(meta[1:]), block: block, blocks: blocks}, true
+	case metaGNSS:
+		pos, ok := parsePosition(meta)
+		if !ok {
+			return metaInfo{}, false
+		}
+		return metaInfo{kind: "gnss", position: pos}, true
+	case metaExtendedCallsign:
+		return metaInfo{
+			kind:      "extended callsign",
+			callsign1: m17.DecodeCallsign(meta[0:6]),
+			callsign2: m17.DecodeCallsign(meta[6:12]),
+		}, true
+	}
+
+	return metaInfo{}, false
+}
+
+// textControl decodes the control byte of a text META block. The high nibble
+// has one bit set per block in the message and the low nibble the bit of this
+// block. A control byte that doesn't fit that layout is taken as a single
+// block message.
+func textControl(control byte) (block, blocks int) {
+	total, this := control>>4, control&0x0F
+	switch {
+	case total != 0x1 && total != 0x3 && total != 0x7 && total != 0xF,
+		bits.OnesCount8(this) != 1, this&total == 0:
+		return 0, 1
+	}
+	return bits.TrailingZeros8(this), bits.OnesCount8(total)
+}
+
+// cleanText converts text META bytes to a printable string, dropping padding
+// and control characters and replacing invalid UTF-8
+func cleanText(b []byte) string {
+	text := strings.ToValidUTF8(strings.TrimRight(string(b), "\x00 "), "\uFFFD")
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// textBlockSize is the number of text bytes after the control byte in META
+const textBlockSize = 13
+
+// textAssembler collects the blocks of a text message sent over several
+// frames, up to four blocks of 13 bytes
+type textAssembler struct {
+	blocks   [4][textBlockSize]byte
+	received int // bit mask of blocks received
+	total    int // number of blocks in the message
+	reported string
+}
+
+// add records a text META field and returns the message when every block
+// has arrived and it differs from the last one returned
+func (a *textAssembler) add(meta []byte) (string, bool) {
+	block, blocks := textControl(meta[0])
+	if blocks != a.total {
+		// A new message layout, so start over
+		*a = textAssembler{total: blocks, reported: a.reported}
+	}
+	copy(a.blocks[block][:], meta[1:])
+	a.received |= 1 << block
+	if a.received != 1<<a.total-1 {
+		return "", false
+	}
+
+	text := a.text()
+	if text == a.reported {
+		return "", false
+	}
+	a.reported = text
+	return text, true
+}
+
+// message returns the last complete message, or if none has completed the
+// blocks received so far, so a stream that ends early still yields its text
+func (a *textAssembler) message() string {
+	if a.reported != "" {
+		return a.reported
+	}
+	return a.text()
+}
+
+// text returns the message from the blocks received so far, in order
+func (a *textAssembler) text() string {
+	var raw []byte
+	for i := 0; i < a.total; i++ {
+		if a.received&(1<<i) != 0 {
+			raw = append(raw, a.blocks[i][:]...)
+		}
+	}
+	return cleanText(raw)
+}
+
+// GNSS META flags after the hemisphere bits
+const (
+	gnssAltitudeValid = 0x04
+	gnssSpeedValid    = 0x08
+)
+
+// Position is a GNSS position from the META field. Altitude, speed and
+// bearing are only present when the sender flags them as valid.
+type Position struct {
+	Latitude  float64  `json:"latitude"`           // decimal degrees, negative for south
+	Longitude float64  `json:"longitude"`          // decimal degrees, negative for west
+	Altitude  *float64 `json:"altitude,omitempty"` // metres
+	Speed     *float64 `json:"speed,omitempty"`    // km/h
+	Bearing   *float64 `json:"bearing,omitempty"`  // degrees from true north
+}
+
+// String formats the position for logging
+func (p Position) String() string {
+	s := fmt.Sprintf("lat=%.5f lon=%.5f", p.Latitude, p.Longitude)
+	if p.Altitude != nil {
+		s += fmt.Sprintf(" alt=%.0fm", *p.Altitude)
+	}
+	if p.Speed != nil {
+		s += fmt.Sprintf(" speed=%.0fkm/h bearing=%.0f", *p.Speed, *p.Bearing)
+	}
+	return s
+}
+
+// equal reports whether two positions are the same
+func (p Position) equal(o Position) bool {
+	same := func(a, b *float64) bool {
+		return (a == nil) == (b == nil) && (a == nil || *a == *b)
+	}
+	return p.Latitude == o.Latitude && p.Longitude == o.Longitude &&
+		same(p.Altitude, o.Altitude) && same(p.Speed, o.Speed) && same(p.Bearing, o.Bearing)
+}
+
+// parsePosition decodes GNSS META data, including the altitude (a 16-bit
+// count of feet offset by 1500) and the bearing and speed (16-bit degrees
+// and 8-bit miles per hour) when they are flagged as valid
+func parsePosition(meta []byte) (Position, bool) {
+	lat, lon, ok := parseGPSMeta(meta)
+	if !ok {
+		return Position{}, false
+	}
+
+	pos := Position{Latitude: lat, Longitude: lon}
+	if meta[8]&gnssAltitudeValid != 0 {
+		alt := (float64(binary.BigEndian.Uint16(meta[9:11])) - 1500) * 0.3048
+		pos.Altitude = &alt
+	}
+	if meta[8]&gnssSpeedValid != 0 {
+		bearing := float64(binary.BigEndian.Uint16(meta[11:13]))
+		speed := float64(meta[13]) * 1.609344
+		pos.Bearing, pos.Speed = &bearing, &speed
+	}
+	return pos, true
+}
+
+// parseGPSMeta decodes the latitude and longitude from GNSS META data
+func parseGPSMeta(meta []byte) (lat, lon float64, ok bool) {
+	if len(meta) != 14 {
+		return 0, 0, false
+	}
+
+	// Whole degrees followed by a 16-bit fraction of a degree
+	lat = float64(meta[2]) + float64(binary.BigEndian.Uint16(meta[3:5]))/65535
+	lon = float64(meta[5]) + float64(binary.BigEndian.Uint16(meta[6:8]))/65535
+	if lat > 90 || lon > 180 {
+		return 0, 0, false
+	}
+
+	// Hemisphere flags
+	if meta[8]&0x01 != 0 {
+		lat = -lat
+	}
+	if meta[8]&0x02 != 0 {
+		lon = -lon
+	}
+
+	return lat, lon, true
+}
+
+// isZero reports whether every byte is zero
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
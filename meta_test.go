@@ -0,0 +1,144 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// textMeta builds a text META field from a control byte and up to 13 bytes
+func textMeta(control byte, text string) []byte {
+	meta := make([]byte, 14)
+	meta[0] = control
+	copy(meta[1:], text)
+	return meta
+}
+
+func TestTextAssemblerAdd(t *testing.T) {
+	type step struct {
+		meta    []byte
+		want    string
+		wantOK  bool
+		message string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"single block", []step{
+			{textMeta(0x11, "HELLO"), "HELLO", true, "HELLO"},
+			{textMeta(0x11, "HELLO"), "", false, "HELLO"},
+		}},
+		{"two blocks out of order", []step{
+			{textMeta(0x32, "THIS IS TEST"), "", false, "THIS IS TEST"},
+			{textMeta(0x31, "HELLO WORLD, "), "HELLO WORLD, THIS IS TEST", true, "HELLO WORLD, THIS IS TEST"},
+			{textMeta(0x31, "HELLO WORLD, "), "", false, "HELLO WORLD, THIS IS TEST"},
+		}},
+		{"new layout starts over", []step{
+			{textMeta(0x31, "PART ONE"), "", false, "PART ONE"},
+			{textMeta(0x11, "SHORT"), "SHORT", true, "SHORT"},
+		}},
+		{"non-printable bytes", []step{
+			{textMeta(0x11, "AB\x01C\xff"), "ABC�", true, "ABC�"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a textAssembler
+			for i, st := range tt.steps {
+				got, ok := a.add(st.meta)
+				if got != st.want || ok != st.wantOK {
+					t.Errorf("add #%d = %q, %t, want %q, %t", i, got, ok, st.want, st.wantOK)
+				}
+				if msg := a.message(); msg != st.message {
+					t.Errorf("message after add #%d = %q, want %q", i, msg, st.message)
+				}
+			}
+		})
+	}
+}
+
+// gnssMeta builds a GNSS META field from its latitude, longitude, flags,
+// altitude, bearing and speed fields
+func gnssMeta(lat byte, latFrac uint16, lon byte, lonFrac uint16, flags byte, alt, bearing uint16, speed byte) []byte {
+	return []byte{0, 0,
+		lat, byte(latFrac >> 8), byte(latFrac),
+		lon, byte(lonFrac >> 8), byte(lonFrac),
+		flags, byte(alt >> 8), byte(alt), byte(bearing >> 8), byte(bearing), speed}
+}
+
+func TestParsePosition(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name string
+		meta []byte
+		want Position
+	}{
+		{"north east", gnssMeta(42, 0x7FFF, 71, 0x4000, 0, 0, 0, 0), Position{Latitude: 42.5, Longitude: 71.25}},
+		{"south west", gnssMeta(33, 0x8000, 70, 0xC000, 0x01|0x02, 0, 0, 0), Position{Latitude: -33.5, Longitude: -70.75}},
+		{"altitude", gnssMeta(42, 0x7FFF, 71, 0x4000, 0x02|0x04, 0x0728, 0, 0),
+			Position{Latitude: 42.5, Longitude: -71.25, Altitude: float(101.19)}},
+		{"below the altitude offset", gnssMeta(42, 0, 71, 0, 0x04, 1000, 0, 0),
+			Position{Latitude: 42, Longitude: 71, Altitude: float(-152.4)}},
+		{"speed and bearing", gnssMeta(42, 0x7FFF, 71, 0x4000, 0x02|0x08, 0, 90, 10),
+			Position{Latitude: 42.5, Longitude: -71.25, Speed: float(16.09), Bearing: float(90)}},
+		{"everything", gnssMeta(42, 0x7FFF, 71, 0x4000, 0x02|0x04|0x08, 0x0728, 90, 10),
+			Position{Latitude: 42.5, Longitude: -71.25, Altitude: float(101.19), Speed: float(16.09), Bearing: float(90)}},
+		{"poles and antimeridian", gnssMeta(90, 0, 180, 0, 0x01, 0, 0, 0), Position{Latitude: -90, Longitude: 180}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePosition(tt.meta)
+			if !ok {
+				t.Fatalf("parsePosition(%X) failed", tt.meta)
+			}
+			near := func(a, b *float64) bool {
+				return (a == nil) == (b == nil) && (a == nil || math.Abs(*a-*b) < 0.01)
+			}
+			if !near(&got.Latitude, &tt.want.Latitude) || !near(&got.Longitude, &tt.want.Longitude) ||
+				!near(got.Altitude, tt.want.Altitude) || !near(got.Speed, tt.want.Speed) || !near(got.Bearing, tt.want.Bearing) {
+				t.Errorf("parsePosition(%X) = %s, want %s", tt.meta, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGPSMetaInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		meta []byte
+	}{
+		{"empty", nil},
+		{"short", gnssMeta(42, 0, 71, 0, 0, 0, 0, 0)[:13]},
+		{"long", append(gnssMeta(42, 0, 71, 0, 0, 0, 0, 0), 0)},
+		{"latitude beyond 90", gnssMeta(90, 1, 71, 0, 0, 0, 0, 0)},
+		{"longitude beyond 180", gnssMeta(42, 0, 180, 1, 0, 0, 0, 0)},
+		{"whole degrees out of range", gnssMeta(200, 0, 250, 0, 0, 0, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if lat, lon, ok := parseGPSMeta(tt.meta); ok {
+				t.Errorf("parseGPSMeta(%X) = %f, %f, want it rejected", tt.meta, lat, lon)
+			}
+			if _, ok := parsePosition(tt.meta); ok {
+				t.Errorf("parsePosition(%X) succeeded, want it rejected", tt.meta)
+			}
+		})
+	}
+}
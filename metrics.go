@@ -0,0 +1,103 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// metrics holds the client counters
+type metrics struct {
+	captured  atomic.Uint64 // datagrams received from the packet source
+	packets   atomic.Uint64 // M17 packets received
+	frames    atomic.Uint64 // Codec 2 frames decoded
+	crcErrors atomic.Uint64 // packets failing the CRC check
+	dropped   atomic.Uint64 // malformed or non-voice packets
+	encrypted atomic.Uint64 // encrypted or packet mode packets
+	filtered  atomic.Uint64 // packets skipped by callsign filters
+}
+
+// writeMetrics writes the counters in the Prometheus text exposition format
+func (c *Client) writeMetrics(w io.Writer) {
+	write := func(name, typ, help string, value uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, typ, name, value)
+	}
+
+	write("m17_datagrams_total", "counter", "Total datagrams received from the capture, socket or reflector.", c.metrics.captured.Load())
+	write("m17_packets_total", "counter", "Total M17 packets received.", c.metrics.packets.Load())
+	write("m17_frames_decoded_total", "counter", "Total Codec 2 frames decoded.", c.metrics.frames.Load())
+	write("m17_crc_errors_total", "counter", "Total M17 packets failing the CRC check.", c.metrics.crcErrors.Load())
+	write("m17_packets_dropped_total", "counter", "Total malformed or non-voice M17 packets.", c.metrics.dropped.Load())
+	write("m17_packets_encrypted_total", "counter", "Total encrypted or packet mode M17 packets ignored.", c.metrics.encrypted.Load())
+	write("m17_packets_filtered_total", "counter", "Total M17 packets skipped by callsign filters.", c.metrics.filtered.Load())
+	write("m17_active_streams", "gauge", "Number of streams currently being received.", uint64(c.streams.count()))
+}
+
+// serveMetrics starts an HTTP server exposing /metrics on addr
+func (c *Client) serveMetrics(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		c.writeMetrics(w)
+	})
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("metrics server failed", "err", err)
+		}
+	}()
+
+	return srv, nil
+}
+
+// logThroughput logs the packets captured and frames decoded over each
+// interval, and the active streams, until the client is closed
+func (c *Client) logThroughput(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastCaptured, lastPackets, lastFrames := c.metrics.captured.Load(), c.metrics.packets.Load(), c.metrics.frames.Load()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			captured, packets, frames := c.metrics.captured.Load(), c.metrics.packets.Load(), c.metrics.frames.Load()
+			slog.Info("throughput",
+				"interval", interval,
+				"captured", captured-lastCaptured,
+				"m17Packets", packets-lastPackets,
+				"framesDecoded", frames-lastFrames,
+				"activeStreams", c.streams.count(),
+			)
+			lastCaptured, lastPackets, lastFrames = captured, packets, frames
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT publisher settings
+const (
+	mqttQueueSize      = 64
+	mqttConnectTimeout = 5 * time.Second
+	mqttPublishTimeout = 5 * time.Second
+	mqttRetryInterval  = 10 * time.Second
+)
+
+// mqttPublisher publishes events to an MQTT broker without blocking the
+// decode path
+type mqttPublisher struct {
+	client mqtt.Client
+	topic  string
+	queue  chan []byte
+}
+
+// newMQTTPublisher creates a publisher for broker (host:port) and topic.
+// The connection is made when the first event is published.
+func newMQTTPublisher(broker, topic string) *mqttPublisher {
+	opts := mqtt.NewClientOptions().
+		AddBroker("tcp://" + broker).
+		SetClientID(fmt.Sprintf("m17gateway-monitor-%d", os.Getpid())).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(mqttRetryInterval).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			slog.Warn("lost MQTT connection", "broker", broker, "err", err)
+		}).
+		SetOnConnectHandler(func(mqtt.Client) {
+			slog.Info("connected to MQTT broker", "broker", broker)
+		})
+
+	return &mqttPublisher{
+		client: mqtt.NewClient(opts),
+		topic:  topic,
+		queue:  make(chan []byte, mqttQueueSize),
+	}
+}
+
+// mqttPayload encodes an event for publishing
+func mqttPayload(ev Event) ([]byte, error) {
+	return json.Marshal(ev)
+}
+
+// publish queues an event, dropping it if the queue is full
+func (p *mqttPublisher) publish(ev Event) {
+	payload, err := mqttPayload(ev)
+	if err != nil {
+		slog.Error("failed to encode MQTT event", "err", err)
+		return
+	}
+
+	select {
+	case p.queue <- payload:
+	default:
+		slog.Warn("MQTT queue full, dropping event", "streamID", hex16(ev.StreamID))
+	}
+}
+
+// run connects to the broker on the first event and publishes queued events
+// until ctx is cancelled. A connect that fails outright, such as for a broker
+// that does not resolve, is tried again on the next event.
+func (p *mqttPublisher) run(ctx context.Context) {
+	connectStarted := false
+	defer func() {
+		if connectStarted {
+			p.client.Disconnect(250)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload := <-p.queue:
+			if !connectStarted {
+				// Wait for the first connection so the event that triggered
+				// it is not dropped. With connect retry enabled a broker that
+				// is down keeps being tried in the background.
+				token := p.client.Connect()
+				if !token.WaitTimeout(mqttConnectTimeout) {
+					slog.Warn("timed out connecting to MQTT broker, will keep retrying")
+					connectStarted = true
+				} else if err := token.Error(); err != nil {
+					slog.Warn("failed to connect to MQTT broker", "err", err)
+				} else {
+					connectStarted = true
+				}
+			}
+			if !p.client.IsConnectionOpen() {
+				slog.Warn("MQTT broker unavailable, dropping event")
+				continue
+			}
+
+			token := p.client.Publish(p.topic, 0, false, payload)
+			if !token.WaitTimeout(mqttPublishTimeout) {
+				slog.Warn("timed out publishing MQTT event")
+			} else if err := token.Error(); err != nil {
+				slog.Warn("failed to publish MQTT event", "err", err)
+			}
+		}
+	}
+}
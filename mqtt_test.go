@@ -0,0 +1,163 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestMQTTPayload(t *testing.T) {
+	when := time.Date(2024, 3, 1, 12, 0, 5, 250_000_000, time.UTC)
+	lat, lon, active := 42.5, -71.25, 0
+	tests := []struct {
+		name string
+		ev   Event
+		want string
+	}{
+		{"start", Event{Seq: 1, Type: eventStart, StreamID: 0x1234, Source: "192.0.2.1:17000", Src: "KC1AWV", SrcName: "Steve",
+			Dst: "M17-XXX A", DstBase: "M17-XXX", DstModule: "A", Timestamp: when},
+			`{"seq":1,"type":"start","streamID":4660,"source":"192.0.2.1:17000","src":"KC1AWV","srcName":"Steve","dst":"M17-XXX A",` +
+				`"dstBase":"M17-XXX","dstModule":"A","frames":0,"duration":0,"timestamp":"2024-03-01T12:00:05.250Z"}`},
+		{"timed out end", Event{Seq: 2, Type: eventEnd, StreamID: 1, Src: "N0CALL", Dst: "@ALL", DstBase: "@ALL", Timestamp: when,
+			Frames: 25, Duration: 1, TimedOut: true, CRCErrors: 2, Text: "HELLO", Position: &Position{Latitude: lat, Longitude: lon}},
+			`{"seq":2,"type":"end","streamID":1,"src":"N0CALL","dst":"@ALL","dstBase":"@ALL","frames":25,"duration":1,"timedOut":true,` +
+				`"crcErrors":2,"text":"HELLO","position":{"latitude":42.5,"longitude":-71.25},"timestamp":"2024-03-01T12:00:05.250Z"}`},
+		{"heartbeat", Event{Seq: 3, Type: eventHeartbeat, Timestamp: when.In(time.FixedZone("EST", -5*3600)), Uptime: 30, Active: &active},
+			`{"seq":3,"type":"heartbeat","streamID":0,"src":"","dst":"","dstBase":"","frames":0,"duration":0,"uptime":30,` +
+				`"activeStreams":0,"timestamp":"2024-03-01T12:00:05.250Z"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mqttPayload(tt.ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("mqttPayload =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeToken is an MQTT token that has already completed
+type fakeToken struct {
+	err error
+}
+
+func (t fakeToken) Wait() bool                     { return true }
+func (t fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t fakeToken) Error() error                   { return t.err }
+func (t fakeToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// fakeMQTTClient is an MQTT client whose connects fail until connectErrs
+// runs out, recording what it publishes
+type fakeMQTTClient struct {
+	mqtt.Client
+	mu          sync.Mutex
+	connectErrs []error
+	connects    int
+	connected   bool
+	published   [][]byte
+}
+
+func (c *fakeMQTTClient) Connect() mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connects++
+	if len(c.connectErrs) > 0 {
+		err := c.connectErrs[0]
+		c.connectErrs = c.connectErrs[1:]
+		return fakeToken{err}
+	}
+	c.connected = true
+	return fakeToken{}
+}
+
+func (c *fakeMQTTClient) IsConnectionOpen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *fakeMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, payload.([]byte))
+	return fakeToken{}
+}
+
+func (c *fakeMQTTClient) Disconnect(uint) {}
+
+func TestMQTTConnectRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		events    int
+		connects  int
+		published int
+	}{
+		{"connects first time", 0, 3, 1, 3},
+		{"first connect fails", 1, 3, 2, 2},
+		{"every connect fails", 3, 3, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeMQTTClient{}
+			for i := 0; i < tt.failures; i++ {
+				client.connectErrs = append(client.connectErrs, errors.New("no such host"))
+			}
+			p := &mqttPublisher{client: client, topic: "m17", queue: make(chan []byte)}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				p.run(ctx)
+			}()
+
+			// The queue is unbuffered, so once the last event is taken the
+			// one before has been handled, and run handles the last before
+			// it sees the cancel
+			for i := 0; i < tt.events; i++ {
+				payload, err := mqttPayload(Event{Seq: uint64(i + 1), Type: eventStart})
+				if err != nil {
+					t.Fatal(err)
+				}
+				p.queue <- payload
+			}
+			cancel()
+			<-done
+
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			published := len(client.published)
+			if client.connects != tt.connects || published != tt.published {
+				t.Errorf("%d connects and %d events published, want %d and %d", client.connects, published, tt.connects, tt.published)
+			}
+		})
+	}
+}
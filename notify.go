@@ -0,0 +1,104 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os/exec"
+	"time"
+)
+
+// Notification settings
+const (
+	notifyToneFreq = 1000 // Hz
+	notifyToneMs   = 150
+	notifyTimeout  = 5 * time.Second // longest we wait for notify-send
+)
+
+// notifier alerts when a watched station starts transmitting, by beeping
+// through the audio device and, where notify-send exists, with a desktop
+// notification
+type notifier struct {
+	sources map[string]struct{}
+	command string // path to notify-send, empty if there is none
+}
+
+// newNotifier creates a notifier for a comma-separated list of callsigns
+func newNotifier(list string) *notifier {
+	n := &notifier{sources: callsignSet(list)}
+	if path, err := exec.LookPath("notify-send"); err == nil {
+		n.command = path
+	} else {
+		slog.Debug("notify-send not found, notifying by beep only", "err", err)
+	}
+	return n
+}
+
+// watches reports whether src is a station to notify on
+func (n *notifier) watches(src string) bool {
+	_, ok := n.sources[normalizeCallsign(src)]
+	return ok
+}
+
+// desktop shows a desktop notification without holding up the caller
+func (n *notifier) desktop(title, body string) {
+	if n.command == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if out, err := exec.CommandContext(ctx, n.command, "--app-name=m17monitor", title, body).CombinedOutput(); err != nil {
+			slog.Warn("failed to send desktop notification", "err", err, "output", string(out))
+		}
+	}()
+}
+
+// notifyTone returns a short beep at the Codec 2 sample rate, faded in and
+// out so it doesn't click
+func notifyTone() []int16 {
+	n := codec2SampleRate * notifyToneMs / 1000
+	fade := n / 10
+	tone := make([]int16, n)
+	for i := range tone {
+		gain := 1.0
+		if i < fade {
+			gain = float64(i) / float64(fade)
+		} else if i >= n-fade {
+			gain = float64(n-1-i) / float64(fade)
+		}
+		tone[i] = int16(gain * 10000 * math.Sin(2*math.Pi*notifyToneFreq*float64(i)/codec2SampleRate))
+	}
+	return tone
+}
+
+// notifyStream alerts that a watched station has started a stream
+func (c *Client) notifyStream(s *stream) {
+	src := s.src
+	if s.name != "" {
+		src = fmt.Sprintf("%s (%s)", s.src, s.name)
+	}
+	slog.Info("watched station transmitting", "src", s.src, "dst", s.dst)
+
+	c.playAudio(notifyTone())
+	c.notify.desktop("M17: "+src, "transmitting to "+s.dst)
+}
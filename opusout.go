@@ -0,0 +1,83 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+
+	"go-m17gateway-monitor/transcode"
+)
+
+// DefaultOpusBitrate is the default Opus bitrate in bits per second
+const DefaultOpusBitrate = 16000
+
+// opusWriter re-encodes decoded audio to Opus and writes each packet
+// prefixed with its length as a 16-bit big-endian integer
+type opusWriter struct {
+	out       *pcmWriter
+	enc       *transcode.Opus
+	resampler *resampler
+	pending   []int16
+}
+
+// newOpusWriter creates an Opus encoder at sampleRate writing to path, a
+// file, named pipe or "-" for stdout
+func newOpusWriter(path string, sampleRate, bitrate int) (*opusWriter, error) {
+	enc, err := transcode.NewOpus(sampleRate, 1, bitrate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize opus: %w", err)
+	}
+	out, err := openOutput(path, "Opus")
+	if err != nil {
+		enc.Close()
+		return nil, err
+	}
+	return &opusWriter{out: out, enc: enc, resampler: newResampler(codec2SampleRate, enc.SampleRate())}, nil
+}
+
+// write resamples 8 kHz audio to the encoder rate and writes every complete
+// frame, keeping the remainder for the next call
+func (o *opusWriter) write(samples []int16) {
+	o.pending = append(o.pending, o.resampler.resample(samples)...)
+
+	n := o.enc.SamplesPerFrame()
+	for len(o.pending) >= n {
+		packet, err := o.enc.Encode(o.pending[:n])
+		o.pending = o.pending[n:]
+		if err != nil {
+			slog.Warn("failed to encode opus frame", "err", err)
+			continue
+		}
+		o.out.writeBytes(binary.BigEndian.AppendUint16(nil, uint16(len(packet))))
+		o.out.writeBytes(packet)
+	}
+}
+
+// HandleFrame encodes and writes the frame audio
+func (o *opusWriter) HandleFrame(f *Frame) {
+	o.write(f.Audio)
+}
+
+// Close closes the output and the encoder
+func (o *opusWriter) Close() error {
+	err := o.out.Close()
+	o.enc.Close()
+	return err
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// handleM17Packet handles an M17 packet mode datagram
+func (c *Client) handleM17Packet(origin string, packet []byte) {
+	c.metrics.packets.Add(1)
+
+	if len(packet) < m17.PacketHeaderSize {
+		c.metrics.dropped.Add(1)
+		slog.Debug("M17 packet mode datagram too short", "length", len(packet))
+		return
+	}
+
+	lsf, err := m17.ParseLSF(packet[4:m17.PacketHeaderSize])
+	if err != nil {
+		c.metrics.crcErrors.Add(1)
+		slog.Debug("invalid packet mode LSF", "err", err)
+		return
+	}
+	if !c.dstFilter.permits(lsf.Dst) || !c.srcFilter.permits(lsf.Src) {
+		c.metrics.filtered.Add(1)
+		return
+	}
+	if lsf.Reserved() != 0 {
+		c.reservedBits(lsf.Src, lsf.Type)
+	}
+	if lsf.EncryptionType() != m17.EncryptionNone {
+		c.metrics.encrypted.Add(1)
+		slog.Debug("ignoring encrypted packet data", "src", lsf.Src, "dst", lsf.Dst, "encryption", lsf.EncryptionName())
+		return
+	}
+
+	typ, content, err := m17.ParsePacketData(packet[m17.PacketHeaderSize:])
+	if err != nil {
+		c.metrics.crcErrors.Add(1)
+		slog.Debug("invalid packet data", "src", lsf.Src, "dst", lsf.Dst, "err", err)
+		return
+	}
+
+	ev := Event{
+		Type:       eventPacket,
+		Source:     origin,
+		Src:        lsf.Src,
+		Dst:        lsf.Dst,
+		Timestamp:  time.Now(),
+		PacketType: m17.PacketTypeName(typ),
+	}
+	if reserved := lsf.Reserved(); reserved != 0 {
+		ev.ReservedBits = hex16(reserved)
+	}
+	attrs := []any{"src", lsf.Src, "dst", lsf.Dst, "type", ev.PacketType, "length", len(content)}
+	if typ == m17.PacketSMS {
+		if ev.Text, err = m17.SMSText(content); err != nil {
+			slog.Debug("invalid SMS", "src", lsf.Src, "dst", lsf.Dst, "err", err)
+		} else {
+			attrs = append(attrs, "text", ev.Text)
+		}
+	}
+
+	slog.Info("received packet data", attrs...)
+	c.emitEvent(ev)
+}
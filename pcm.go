@@ -0,0 +1,122 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// pcmWriter writes raw 16-bit PCM to a file, named pipe or stdout
+type pcmWriter struct {
+	w     io.WriteCloser
+	path  string
+	order binary.ByteOrder
+}
+
+// newPCMWriter opens path for raw PCM output in the given byte order, or
+// stdout if path is "-". Opening a named pipe blocks until a reader opens the
+// other end.
+func newPCMWriter(path string, order binary.ByteOrder) (*pcmWriter, error) {
+	p, err := openOutput(path, "PCM")
+	if err != nil {
+		return nil, err
+	}
+	p.order = order
+	return p, nil
+}
+
+// pcmByteOrder parses a -pcm-endian setting, little-endian if unset. It only
+// applies to -pcmout: oto takes 16-bit samples little-endian on every
+// platform, so the audio device is always fed that order.
+func pcmByteOrder(name string) (binary.ByteOrder, error) {
+	switch name {
+	case "", "little":
+		return binary.LittleEndian, nil
+	case "big":
+		return binary.BigEndian, nil
+	}
+	return nil, fmt.Errorf("invalid PCM byte order %q: must be little or big", name)
+}
+
+// openOutput opens path for writing a raw stream, or stdout if path is "-"
+func openOutput(path, kind string) (*pcmWriter, error) {
+	if path == "-" {
+		// Report a closed pipe as a write error instead of exiting
+		signal.Ignore(syscall.SIGPIPE)
+		return &pcmWriter{w: os.Stdout, path: path}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s output %s: %w", kind, path, err)
+	}
+	return &pcmWriter{w: f, path: path}, nil
+}
+
+// write writes samples, closing the output if the reader has gone away
+func (p *pcmWriter) write(samples []int16) {
+	p.writeBytes(pcmBytesOrder(samples, p.order))
+}
+
+// HandleFrame writes the frame audio
+func (p *pcmWriter) HandleFrame(f *Frame) {
+	p.write(f.Audio)
+}
+
+// writeBytes writes encoded data, closing the output if the reader has gone away
+func (p *pcmWriter) writeBytes(b []byte) {
+	if p.w == nil {
+		return
+	}
+	if _, err := p.w.Write(b); err != nil {
+		slog.Warn("stopping output", "path", p.path, "err", err)
+		p.Close()
+	}
+}
+
+// Close closes the output
+func (p *pcmWriter) Close() error {
+	if p.w == nil || p.w == os.Stdout {
+		p.w = nil
+		return nil
+	}
+	err := p.w.Close()
+	p.w = nil
+	return err
+}
+
+// pcmBytes packs samples as 16-bit little-endian PCM, the format of the audio
+// device and WAV files
+func pcmBytes(samples []int16) []byte {
+	return pcmBytesOrder(samples, binary.LittleEndian)
+}
+
+// pcmBytesOrder packs samples as 16-bit PCM in the given byte order
+func pcmBytesOrder(samples []int16, order binary.ByteOrder) []byte {
+	buf := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		order.PutUint16(buf[i*2:], uint16(sample))
+	}
+	return buf
+}
@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPCMWriter(t *testing.T) {
+	samples := []int16{1, -2, 0x1234, -32768}
+	tests := []struct {
+		endian  string
+		want    []byte
+		wantErr bool
+	}{
+		{"", []byte{0x01, 0x00, 0xFE, 0xFF, 0x34, 0x12, 0x00, 0x80}, false},
+		{"little", []byte{0x01, 0x00, 0xFE, 0xFF, 0x34, 0x12, 0x00, 0x80}, false},
+		{"big", []byte{0x00, 0x01, 0xFF, 0xFE, 0x12, 0x34, 0x80, 0x00}, false},
+		{"Big", nil, true},
+		{"network", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endian, func(t *testing.T) {
+			order, err := pcmByteOrder(tt.endian)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("pcmByteOrder(%q) = %v, want an error", tt.endian, order)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(t.TempDir(), "out.pcm")
+			p, err := newPCMWriter(path, order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.HandleFrame(&Frame{Audio: samples})
+			if err := p.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("wrote % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPCMBytesPlayback(t *testing.T) {
+	// The audio device takes little-endian samples whatever -pcm-endian says
+	want := []byte{0x01, 0x00, 0xFE, 0xFF, 0x34, 0x12, 0x00, 0x80}
+	if got := pcmBytes([]int16{1, -2, 0x1234, -32768}); !bytes.Equal(got, want) {
+		t.Errorf("pcmBytes = % X, want % X", got, want)
+	}
+}
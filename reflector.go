@@ -0,0 +1,199 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// Reflector control packet MAGIC constants
+const (
+	MagicConn = "CONN"
+	MagicAckn = "ACKN"
+	MagicNack = "NACK"
+	MagicPing = "PING"
+	MagicPong = "PONG"
+	MagicDisc = "DISC"
+)
+
+// DefaultPingTimeout is how many seconds we wait for a reflector PING or
+// other packet before relinking
+const DefaultPingTimeout = 30
+
+// reflector is a connection to an M17 reflector
+type reflector struct {
+	conn     *net.UDPConn
+	callsign []byte // our encoded callsign
+	module   byte
+	linked   atomic.Bool // set once CONN has been sent
+}
+
+// dialReflector opens a UDP socket to a reflector
+func dialReflector(addr, callsign, module string) (*reflector, error) {
+	encoded, err := m17.EncodeCallsign(callsign)
+	if err != nil {
+		return nil, fmt.Errorf("invalid callsign: %w", err)
+	}
+	if len(module) != 1 || module[0] < 'A' || module[0] > 'Z' {
+		return nil, fmt.Errorf("invalid module %q: must be a single letter A-Z", module)
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve reflector %q: %w", addr, err)
+	}
+
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to reflector %q: %w", addr, err)
+	}
+
+	return &reflector{
+		conn:     conn,
+		callsign: encoded,
+		module:   module[0],
+	}, nil
+}
+
+// connPacket builds a CONN packet linking our callsign to a module
+func (r *reflector) connPacket() []byte {
+	packet := make([]byte, 0, 11)
+	packet = append(packet, MagicConn...)
+	packet = append(packet, r.callsign...)
+	return append(packet, r.module)
+}
+
+// pongPacket builds a PONG reply to a reflector PING
+func (r *reflector) pongPacket() []byte {
+	packet := make([]byte, 0, 10)
+	packet = append(packet, MagicPong...)
+	return append(packet, r.callsign...)
+}
+
+// discPacket builds a DISC packet releasing our slot on the reflector
+func (r *reflector) discPacket() []byte {
+	packet := make([]byte, 0, 10)
+	packet = append(packet, MagicDisc...)
+	return append(packet, r.callsign...)
+}
+
+// send writes a packet to the reflector
+func (r *reflector) send(packet []byte) error {
+	_, err := r.conn.Write(packet)
+	return err
+}
+
+// close sends DISC if we linked to a module, then closes the socket
+func (r *reflector) close() {
+	if r.linked.Load() {
+		if err := r.send(r.discPacket()); err != nil {
+			slog.Warn("failed to send DISC", "err", err)
+		}
+	}
+	r.conn.Close()
+}
+
+// errRefused is returned when the reflector refuses to link us
+var errRefused = errors.New("reflector refused connection")
+
+// readReflector links to the reflector module and reads packets until the
+// socket is closed. If the link is lost it is re-established with backoff.
+func (c *Client) readReflector() {
+	delay := retryInitialDelay
+	for {
+		acked, err := c.serveReflector()
+		switch {
+		case errors.Is(err, net.ErrClosed), c.ctx.Err() != nil:
+			return
+		case errors.Is(err, errRefused):
+			slog.Error("reflector refused connection", "module", string(c.reflector.module))
+			return
+		}
+		if acked {
+			delay = retryInitialDelay
+		}
+
+		slog.Warn("lost reflector link, relinking", "err", err, "retryIn", delay)
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// serveReflector sends CONN and handles packets until the link fails. It
+// reports whether the reflector acknowledged the link before then.
+func (c *Client) serveReflector() (acked bool, err error) {
+	if err := c.reflector.send(c.reflector.connPacket()); err != nil {
+		return false, fmt.Errorf("failed to send CONN: %w", err)
+	}
+	c.reflector.linked.Store(true)
+
+	timeout := time.Duration(c.cfg.PingTimeout) * time.Second
+	buf := make([]byte, 1500)
+	for {
+		// Reflectors PING linked clients regularly, so silence means the
+		// reflector has gone away or forgotten us
+		if err := c.reflector.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return acked, fmt.Errorf("failed to set read deadline: %w", err)
+		}
+		n, err := c.reflector.conn.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return acked, fmt.Errorf("no packets from reflector for %s", timeout)
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return acked, err
+			}
+			return acked, fmt.Errorf("failed to read from reflector: %w", err)
+		}
+		if n < 4 {
+			continue
+		}
+
+		packet := buf[:n]
+		switch string(packet[:4]) {
+		case MagicAckn:
+			acked = true
+			slog.Info("connected to reflector", "module", string(c.reflector.module))
+		case MagicNack:
+			c.reflector.linked.Store(false)
+			return acked, errRefused
+		case MagicPing:
+			if err := c.reflector.send(c.reflector.pongPacket()); err != nil {
+				slog.Warn("failed to send PONG", "err", err)
+			}
+		case MagicDisc:
+			// Either the reflector dropped us or it acknowledged our DISC
+			c.reflector.linked.Store(false)
+			return acked, errors.New("disconnected by reflector")
+		default:
+			c.handlePacket(c.reflector.conn.RemoteAddr().String(), packet)
+		}
+	}
+}
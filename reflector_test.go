@@ -0,0 +1,139 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// fakeReflector is a UDP socket standing in for a reflector
+type fakeReflector struct {
+	t      *testing.T
+	conn   *net.UDPConn
+	client *net.UDPAddr // where the last packet came from
+}
+
+// newFakeReflector listens on a loopback port
+func newFakeReflector(t *testing.T) *fakeReflector {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &fakeReflector{t: t, conn: conn}
+}
+
+// expect reads the next packet and checks it is want
+func (r *fakeReflector) expect(want []byte) {
+	r.t.Helper()
+	buf := make([]byte, 1500)
+	r.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, addr, err := r.conn.ReadFromUDP(buf)
+	if err != nil {
+		r.t.Fatalf("waiting for %q: %v", want[:4], err)
+	}
+	r.client = addr
+	if !bytes.Equal(buf[:n], want) {
+		r.t.Fatalf("got packet %q, want %q", buf[:n], want)
+	}
+}
+
+// send writes a packet to the client
+func (r *fakeReflector) send(packet []byte) {
+	r.t.Helper()
+	if _, err := r.conn.WriteToUDP(packet, r.client); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// linkedClient starts a client linking to the fake reflector as N0CALL on
+// module A and acknowledges the link
+func linkedClient(t *testing.T, r *fakeReflector) *Client {
+	t.Helper()
+	c, err := NewClientFromReflector(Config{
+		Connect:       r.conn.LocalAddr().String(),
+		Callsign:      "N0CALL",
+		Module:        "A",
+		PingTimeout:   DefaultPingTimeout,
+		NoSound:       true,
+		StreamTimeout: DefaultStreamTimeout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	c.start()
+
+	r.expect(reflectorPacket(t, MagicConn, "N0CALL", 'A'))
+	r.send([]byte(MagicAckn))
+	return c
+}
+
+// reflectorPacket builds a control packet: MAGIC, an encoded callsign and
+// any trailing bytes
+func reflectorPacket(t *testing.T, magic, callsign string, extra ...byte) []byte {
+	t.Helper()
+	encoded, err := m17.EncodeCallsign(callsign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(append([]byte(magic), encoded...), extra...)
+}
+
+func TestReflectorPing(t *testing.T) {
+	r := newFakeReflector(t)
+	linkedClient(t, r)
+
+	for i := 0; i < 2; i++ {
+		r.send(reflectorPacket(t, MagicPing, "M17-XXX"))
+		r.expect(reflectorPacket(t, MagicPong, "N0CALL"))
+	}
+}
+
+func TestReflectorDisconnect(t *testing.T) {
+	r := newFakeReflector(t)
+	c := linkedClient(t, r)
+
+	c.Close()
+	r.expect(reflectorPacket(t, MagicDisc, "N0CALL"))
+}
+
+func TestReflectorRefusedNoDisconnect(t *testing.T) {
+	r := newFakeReflector(t)
+	c := linkedClient(t, r)
+
+	// A refused link holds no slot, so closing sends no DISC
+	r.send([]byte(MagicNack))
+	select {
+	case <-c.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client still running after NACK")
+	}
+	c.Close()
+
+	r.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, _, err := r.conn.ReadFromUDP(make([]byte, 1500)); err == nil {
+		t.Errorf("got a %d-byte packet after a refused link, want none", n)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// roster maps callsigns to operator names loaded from a CSV file
+type roster struct {
+	path  string
+	mu    sync.RWMutex
+	names map[string]string
+}
+
+// loadRoster reads a roster from a CSV file of callsign,name rows. Extra
+// columns, a callsign,name header row and lines starting with # are ignored.
+func loadRoster(path string) (*roster, error) {
+	r := &roster{path: path}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload re-reads the roster file, keeping the current names on failure
+func (r *roster) reload() error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to open roster: %w", err)
+	}
+	defer f.Close()
+
+	names := make(map[string]string)
+	cr := csv.NewReader(f)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse roster %s: %w", r.path, err)
+		}
+		if len(record) < 2 {
+			continue
+		}
+
+		call, name := normalizeCallsign(record[0]), strings.TrimSpace(record[1])
+		if call == "" || name == "" || call == "CALLSIGN" {
+			continue
+		}
+		names[call] = name
+	}
+
+	r.mu.Lock()
+	r.names = names
+	r.mu.Unlock()
+	return nil
+}
+
+// size returns the number of callsigns in the roster
+func (r *roster) size() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.names)
+}
+
+// lookup returns the operator name for a callsign, or "" if it is not in the
+// roster. Matching ignores case and padding, and a callsign with a suffix
+// such as "KC1AWV D", "KC1AWV-7" or "KC1AWV/P" falls back to its base.
+func (r *roster) lookup(callsign string) string {
+	if r == nil {
+		return ""
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := normalizeCallsign(callsign)
+	if name, ok := r.names[key]; ok {
+		return name
+	}
+	if i := strings.IndexAny(key, " -/"); i > 0 {
+		return r.names[key[:i]]
+	}
+	return ""
+}
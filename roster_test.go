@@ -0,0 +1,132 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// writeRoster writes a roster file and returns its path
+func writeRoster(t *testing.T, dir, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, "roster.csv")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRosterLookup(t *testing.T) {
+	path := writeRoster(t, t.TempDir(), `callsign,name
+# club members
+kc1awv , Steve Miller, extra column
+N0CALL,"Doe, Jane"
+W1AW
+W1AW-9,
+`)
+	r, err := loadRoster(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		callsign string
+		want     string
+	}{
+		{"KC1AWV", "Steve Miller"},
+		{"kc1awv", "Steve Miller"},
+		{"KC1AWV   ", "Steve Miller"},
+		{"KC1AWV D", "Steve Miller"},
+		{"KC1AWV-7", "Steve Miller"},
+		{"KC1AWV/P", "Steve Miller"},
+		{"N0CALL", "Doe, Jane"},
+		{"W1AW", ""},
+		{"W1AW-9", ""},
+		{"CALLSIGN", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.callsign, func(t *testing.T) {
+			if got := r.lookup(tt.callsign); got != tt.want {
+				t.Errorf("lookup(%q) = %q, want %q", tt.callsign, got, tt.want)
+			}
+		})
+	}
+	if r.size() != 2 {
+		t.Errorf("roster holds %d callsigns, want 2", r.size())
+	}
+}
+
+func TestRosterReload(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string // replaces the roster file, or removes it if empty
+		wantErr  bool
+		want     string
+	}{
+		{"updated", "KC1AWV,Steve\n", false, "Steve"},
+		{"malformed", "KC1AWV,\"Steve\n", true, "Steve Miller"},
+		{"missing", "", true, "Steve Miller"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeRoster(t, t.TempDir(), "KC1AWV,Steve Miller\n")
+			r, err := loadRoster(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.contents == "" {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				writeRoster(t, filepath.Dir(path), tt.contents)
+			}
+			if err := r.reload(); (err != nil) != tt.wantErr {
+				t.Errorf("reload: %v, want an error %t", err, tt.wantErr)
+			}
+			if got := r.lookup("KC1AWV"); got != tt.want {
+				t.Errorf("lookup after reload = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRosterStreamName(t *testing.T) {
+	path := writeRoster(t, t.TempDir(), "KC1AWV,Steve Miller\n")
+	c, _ := newTestClient(t, Config{Roster: path})
+	events := captureEvents(t, c)
+	c.handleStreamFrame("", makeFrame(t, 1, "KC1AWV", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize)))
+	c.handleStreamFrame("", makeFrame(t, 2, "N0CALL", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize)))
+
+	names := make(map[uint16]string)
+	for _, s := range c.streams.snapshot() {
+		names[s.id] = s.name
+	}
+	if names[1] != "Steve Miller" || names[2] != "" {
+		t.Errorf("stream names %q, want Steve Miller for stream 1 only", names)
+	}
+	if ev := events(); len(ev) != 2 || ev[0].SrcName != "Steve Miller" || ev[1].SrcName != "" {
+		t.Errorf("start events %+v, want Steve Miller named on the first only", ev)
+	}
+}
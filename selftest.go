@@ -0,0 +1,134 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"go-m17gateway-monitor/codec2"
+	"go-m17gateway-monitor/m17"
+)
+
+// Self-test settings
+const (
+	selfTestSrc      = "N0CALL"
+	selfTestDst      = "M17-SLF A"
+	selfTestStreamID = 0x1717
+	selfTestFrames   = 25   // one second of audio
+	selfTestTone     = 1000 // Hz
+)
+
+// buildStreamFrame assembles an M17 IP stream frame with a valid CRC
+func buildStreamFrame(streamID uint16, src, dst string, typ uint16, frameNumber uint16, payload []byte) ([]byte, error) {
+	encodedDst, err := m17.EncodeCallsign(dst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	encodedSrc, err := m17.EncodeCallsign(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source: %w", err)
+	}
+
+	frame := make([]byte, m17.StreamFrameSize)
+	copy(frame[0:4], m17.MagicStream)
+	binary.BigEndian.PutUint16(frame[4:6], streamID)
+	copy(frame[6:12], encodedDst)
+	copy(frame[12:18], encodedSrc)
+	binary.BigEndian.PutUint16(frame[18:20], typ)
+	binary.BigEndian.PutUint16(frame[34:36], frameNumber)
+	copy(frame[36:52], payload)
+	binary.BigEndian.PutUint16(frame[52:54], m17.CRC(frame[:52]))
+	return frame, nil
+}
+
+// runSelfTest encodes a tone with Codec 2, wraps it in M17 stream frames and
+// checks that the packet path decodes it back to audio with the right callsigns
+func runSelfTest() error {
+	enc, err := codec2.New(codec2.MODE_3200)
+	if err != nil {
+		return fmt.Errorf("failed to initialize codec2 encoder: %w", err)
+	}
+	defer enc.Close()
+
+	c, err := newClient(Config{NoSound: true, StreamTimeout: DefaultStreamTimeout})
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+
+	var frames []*Frame
+	c.SetFrameHandler(FrameHandlerFunc(func(f *Frame) {
+		frames = append(frames, f)
+	}))
+
+	// Stream mode, voice, no encryption
+	const typ = 0x0001 | 0b10<<1
+
+	half := enc.SamplesPerFrame()
+	n := 0
+	for fn := uint16(0); fn < selfTestFrames; fn++ {
+		var payload []byte
+		for i := 0; i < codec2FramesPerPayload; i++ {
+			samples := make([]int16, half)
+			for j := range samples {
+				samples[j] = int16(8000 * math.Sin(2*math.Pi*selfTestTone*float64(n)/codec2SampleRate))
+				n++
+			}
+			bits, err := enc.Encode(samples)
+			if err != nil {
+				return fmt.Errorf("failed to encode tone: %w", err)
+			}
+			payload = append(payload, bits...)
+		}
+
+		frameNumber := fn
+		if fn == selfTestFrames-1 {
+			frameNumber |= m17.LastFrameFlag
+		}
+		frame, err := buildStreamFrame(selfTestStreamID, selfTestSrc, selfTestDst, typ, frameNumber, payload)
+		if err != nil {
+			return err
+		}
+		c.handlePacket("selftest", frame)
+	}
+
+	if len(frames) != selfTestFrames {
+		return fmt.Errorf("decoded %d of %d frames", len(frames), selfTestFrames)
+	}
+	var peak int16
+	for _, f := range frames {
+		if f.Src != selfTestSrc || f.Dst != selfTestDst {
+			return fmt.Errorf("callsigns decoded as %s -> %s, want %s -> %s", f.Src, f.Dst, selfTestSrc, selfTestDst)
+		}
+		if len(f.Audio) != samplesPerFrame {
+			return fmt.Errorf("frame %d has %d samples, want %d", f.FrameNumber, len(f.Audio), samplesPerFrame)
+		}
+		for _, sample := range f.Audio {
+			peak = max(peak, sample, -sample)
+		}
+	}
+	if peak == 0 {
+		return fmt.Errorf("decoded audio is silent")
+	}
+	if !frames[len(frames)-1].IsLast {
+		return fmt.Errorf("last frame flag was not decoded")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+)
+
+// NewClientFromSocket creates a new M17 client reading datagrams sent to a
+// local UDP address, e.g. when this host is the reflector's forward target.
+// Unlike capturing, this needs no special privileges.
+func NewClientFromSocket(cfg Config) (*Client, error) {
+	laddr, err := net.ResolveUDPAddr("udp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve listen address %q: %w", cfg.Listen, err)
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %q: %w", cfg.Listen, err)
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.socket = conn
+	slog.Info("listening for M17 datagrams", "addr", conn.LocalAddr())
+
+	return c, nil
+}
+
+// readSocket reads datagrams from the UDP socket until it is closed
+func (c *Client) readSocket() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := c.socket.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("failed to read from socket", "err", err)
+			}
+			return
+		}
+		slog.Debug("received packet", "from", addr)
+		c.handlePacket(addr.String(), buf[:n])
+	}
+}
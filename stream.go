@@ -0,0 +1,342 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go-m17gateway-monitor/m17"
+)
+
+// DefaultStreamTimeout is the default number of milliseconds a stream may go
+// without packets before it is considered ended and reaped
+const DefaultStreamTimeout = 2000
+
+// stream represents a single M17 transmission
+type stream struct {
+	id           uint16
+	origin       string // address of the reflector or sender the stream came from
+	src          string
+	name         string // operator name of src from the roster, if known
+	dst          string
+	started      time.Time
+	lastSeen     time.Time
+	lastFrame    uint16
+	gap          int // frames missed just before the last accepted frame
+	packets      int
+	crcErrors    int // packets for this StreamID that failed the CRC check
+	decodeErrors int // voice frames Codec 2 failed to decode
+	recording    *wavWriter
+	scrambler    *scrambler     // descrambler state, created on the first scrambled frame
+	highPass     *highPass      // DC blocking filter state, created on the first filtered frame
+	text         *textAssembler // text META blocks, created on the first text frame
+	position     *Position      // last GNSS position reported
+	reserved     uint16         // reserved TYPE bits last seen set, in place
+	lsf          m17.LSF        // last LSF carried, for frames that arrive without one
+}
+
+// summary describes a finished stream in one line
+func (s *stream) summary(timedOut bool) string {
+	src := s.src
+	if s.name != "" {
+		src += " (" + s.name + ")"
+	}
+	line := fmt.Sprintf("%s -> %s, %d frames, %.1f s, StreamID=0x%04X",
+		src, s.dst, s.packets, s.lastSeen.Sub(s.started).Seconds(), s.id)
+	if s.crcErrors > 0 || s.decodeErrors > 0 {
+		line += fmt.Sprintf(", %d CRC errors, %d decode errors", s.crcErrors, s.decodeErrors)
+	}
+	if timedOut {
+		line += " (timed out)"
+	}
+	return line
+}
+
+// streamKey identifies a stream: its StreamID and where it came from, so the
+// same StreamID arriving from two reflectors is tracked as two streams
+type streamKey struct {
+	origin string
+	id     uint16
+}
+
+// endedStream is a stream that ended with its last frame, remembered for the
+// timeout so duplicate and late frames of it don't start a new stream
+type endedStream struct {
+	src       string
+	dst       string
+	lastFrame uint16
+	ended     time.Time
+}
+
+// streamTracker tracks active streams keyed by origin and StreamID
+type streamTracker struct {
+	mu      sync.Mutex
+	streams map[streamKey]*stream
+	ended   map[streamKey]endedStream
+	timeout time.Duration
+}
+
+// newStreamTracker creates a new stream tracker
+func newStreamTracker(timeout time.Duration) *streamTracker {
+	return &streamTracker{
+		streams: make(map[streamKey]*stream),
+		ended:   make(map[streamKey]endedStream),
+		timeout: timeout,
+	}
+}
+
+// update records a packet for a stream. It reports whether the stream is new
+// and whether the frame follows the last one accepted; duplicate and late
+// frames are not counted. name is the operator name of src, kept by a new
+// stream for its lifetime.
+//
+// StreamIDs are only 16 bits, so a packet whose StreamID matches a tracked
+// stream but whose source or destination differs, or which arrives after the
+// stream has gone quiet for longer than the timeout, starts a new stream. The
+// stream it displaces is returned as replaced so it can be finished.
+//
+// A frame of a stream that ended within the timeout, numbered no later than
+// its last frame, is a straggler rather than a new stream: the returned
+// stream is nil.
+func (t *streamTracker) update(origin string, id uint16, src, name, dst string, frameNumber uint16, now time.Time) (s, replaced *stream, isNew, inOrder bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := streamKey{origin, id}
+	if e, ok := t.ended[key]; ok {
+		if e.src == src && e.dst == dst && now.Sub(e.ended) <= t.timeout && !frameAfter(frameNumber, e.lastFrame) {
+			return nil, nil, false, false
+		}
+		delete(t.ended, key)
+	}
+	s, ok := t.streams[key]
+	if ok && (s.src != src || s.dst != dst || now.Sub(s.lastSeen) > t.timeout) {
+		replaced, ok = s, false
+	}
+	if !ok {
+		s = &stream{
+			id:      id,
+			origin:  origin,
+			src:     src,
+			name:    name,
+			dst:     dst,
+			started: now,
+		}
+		t.streams[key] = s
+	} else if !frameAfter(frameNumber, s.lastFrame) {
+		return s, nil, false, false
+	}
+
+	s.gap = 0
+	if ok {
+		s.gap = int((frameNumber-s.lastFrame)&m17.FrameNumberMask) - 1
+	}
+	s.lastSeen = now
+	s.lastFrame = frameNumber
+	s.packets++
+
+	return s, replaced, !ok, true
+}
+
+// crcError counts a CRC failure against the stream from origin with this
+// StreamID, if any.
+// The StreamID itself may be corrupt, so unknown IDs are ignored.
+func (t *streamTracker) crcError(origin string, id uint16) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.streams[streamKey{origin, id}]; ok {
+		s.crcErrors++
+	}
+}
+
+// setLSF records the last LSF a stream's frames carried. META is copied, as
+// it points into a packet buffer that may be reused.
+func (t *streamTracker) setLSF(s *stream, lsf m17.LSF) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lsf.Meta = bytes.Clone(lsf.Meta)
+	s.lsf = lsf
+}
+
+// lastLSF returns the last LSF carried by the stream from origin with this
+// StreamID, or false if no such stream is being tracked
+func (t *streamTracker) lastLSF(origin string, id uint16) (m17.LSF, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.streams[streamKey{origin, id}]
+	if !ok || s.lsf.IsEmpty() {
+		return m17.LSF{}, false
+	}
+	return s.lsf, true
+}
+
+// setReserved records the reserved TYPE bits last seen set on a stream
+func (t *streamTracker) setReserved(s *stream, reserved uint16) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s.reserved = reserved
+}
+
+// addText records a text META field for a stream and returns its message
+// when every block has arrived and it differs from the last one returned
+func (t *streamTracker) addText(s *stream, meta []byte) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s.text == nil {
+		s.text = &textAssembler{}
+	}
+	return s.text.add(meta)
+}
+
+// setPosition records a GNSS position for a stream and reports whether it
+// differs from the last one recorded
+func (t *streamTracker) setPosition(s *stream, pos Position) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s.position != nil && s.position.equal(pos) {
+		return false
+	}
+	s.position = &pos
+	return true
+}
+
+// decodeError counts a Codec 2 decode failure against a stream
+func (t *streamTracker) decodeError(s *stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s.decodeErrors++
+}
+
+// frameAfter reports whether frame number a comes after b, allowing for the
+// 15-bit frame counter wrapping around
+func frameAfter(a, b uint16) bool {
+	diff := (a - b) & m17.FrameNumberMask
+	return diff != 0 && diff < (m17.FrameNumberMask+1)/2
+}
+
+// remove stops tracking a stream that ended with its last frame and returns
+// it, or nil if it is unknown. The stream is remembered for the timeout so
+// frames of it arriving afterwards are not taken for a new stream.
+func (t *streamTracker) remove(origin string, id uint16) *stream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := streamKey{origin, id}
+	s, ok := t.streams[key]
+	if !ok {
+		return nil
+	}
+	delete(t.streams, key)
+	t.ended[key] = endedStream{src: s.src, dst: s.dst, lastFrame: s.lastFrame, ended: s.lastSeen}
+	return s
+}
+
+// expire removes and returns streams that have not been seen within the
+// timeout, and forgets streams that ended before it
+func (t *streamTracker) expire(now time.Time) []*stream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, e := range t.ended {
+		if now.Sub(e.ended) > t.timeout {
+			delete(t.ended, key)
+		}
+	}
+
+	var expired []*stream
+	for key, s := range t.streams {
+		if now.Sub(s.lastSeen) > t.timeout {
+			expired = append(expired, s)
+			delete(t.streams, key)
+		}
+	}
+	return expired
+}
+
+// drain removes and returns all tracked streams
+func (t *streamTracker) drain() []*stream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	drained := make([]*stream, 0, len(t.streams))
+	for key, s := range t.streams {
+		drained = append(drained, s)
+		delete(t.streams, key)
+	}
+	return drained
+}
+
+// streamInfo is the part of an active stream shown by the TUI and logged on
+// SIGUSR1. Every field is only written under the tracker lock.
+type streamInfo struct {
+	id           uint16
+	origin       string
+	src          string
+	name         string
+	dst          string
+	started      time.Time
+	lastSeen     time.Time
+	packets      int
+	crcErrors    int
+	decodeErrors int
+}
+
+// snapshot returns the details of the active streams, oldest first
+func (t *streamTracker) snapshot() []streamInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	streams := make([]streamInfo, 0, len(t.streams))
+	for _, s := range t.streams {
+		streams = append(streams, streamInfo{
+			id:           s.id,
+			origin:       s.origin,
+			src:          s.src,
+			name:         s.name,
+			dst:          s.dst,
+			started:      s.started,
+			lastSeen:     s.lastSeen,
+			packets:      s.packets,
+			crcErrors:    s.crcErrors,
+			decodeErrors: s.decodeErrors,
+		})
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].started.Before(streams[j].started)
+	})
+	return streams
+}
+
+// count returns the number of active streams
+func (t *streamTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.streams)
+}
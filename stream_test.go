@@ -0,0 +1,484 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go-m17gateway-monitor/m17"
+)
+
+func TestFrameAfter(t *testing.T) {
+	tests := []struct {
+		a, b uint16
+		want bool
+	}{
+		{1, 0, true},
+		{0, 1, false},
+		{5, 5, false},
+		{0x3FFF, 0, true},
+		{0x4000, 0, false},
+		{0, 0x7FFF, true},
+		{2, 0x7FFE, true},
+		{0x7FFF, 0, false},
+		{0x7FFE, 2, false},
+	}
+	for _, tt := range tests {
+		if got := frameAfter(tt.a, tt.b); got != tt.want {
+			t.Errorf("frameAfter(%#04x, %#04x) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestOutOfOrderFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []uint16
+		want []uint16
+	}{
+		{"duplicate and late", []uint16{0, 1, 1, 3, 2}, []uint16{0, 1, 3}},
+		{"in order", []uint16{0, 1, 2, 3}, []uint16{0, 1, 2, 3}},
+		{"across the wrap", []uint16{0x7FFE, 0x7FFF, 0, 0x7FFF, 1}, []uint16{0x7FFE, 0x7FFF, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{})
+			for _, fn := range tt.in {
+				c.handleStreamFrame("", makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, fn, make([]byte, m17.PayloadSize)))
+			}
+			var got []uint16
+			for _, f := range *frames {
+				got = append(got, f.FrameNumber)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("played frames %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndedStreamFrames(t *testing.T) {
+	type frame struct {
+		src string
+		fn  uint16
+	}
+	tests := []struct {
+		name   string
+		frames []frame
+		starts int
+		ends   int
+		played int
+	}{
+		{"late frame", []frame{{"N0CALL", 3}, {"N0CALL", 4 | m17.LastFrameFlag}, {"N0CALL", 3}}, 1, 1, 2},
+		{"resent last frame", []frame{{"N0CALL", 3}, {"N0CALL", 4 | m17.LastFrameFlag}, {"N0CALL", 4 | m17.LastFrameFlag}}, 1, 1, 2},
+		{"new source", []frame{{"N0CALL", 3}, {"N0CALL", 4 | m17.LastFrameFlag}, {"KC1AWV", 0}}, 2, 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{})
+			events := captureEvents(t, c)
+			for _, f := range tt.frames {
+				c.handleStreamFrame("", makeFrame(t, 1, f.src, "M17-XXX A", voiceType, nil, f.fn, make([]byte, m17.PayloadSize)))
+			}
+
+			starts, ends := 0, 0
+			for _, ev := range events() {
+				switch ev.Type {
+				case eventStart:
+					starts++
+				case eventEnd:
+					ends++
+				}
+			}
+			if starts != tt.starts || ends != tt.ends {
+				t.Errorf("%d start and %d end events, want %d and %d", starts, ends, tt.starts, tt.ends)
+			}
+			if len(*frames) != tt.played {
+				t.Errorf("played %d frames, want %d", len(*frames), tt.played)
+			}
+			if c.streams.count() != tt.starts-tt.ends {
+				t.Errorf("tracking %d streams, want %d", c.streams.count(), tt.starts-tt.ends)
+			}
+		})
+	}
+}
+
+func TestStreamTrackerEnded(t *testing.T) {
+	const timeout = 2 * time.Second
+	tests := []struct {
+		name  string
+		src   string
+		fn    uint16
+		after time.Duration
+		isNew bool
+	}{
+		{"late frame", "N0CALL", 3, 40 * time.Millisecond, false},
+		{"last frame again", "N0CALL", 4, 40 * time.Millisecond, false},
+		{"late frame after the timeout", "N0CALL", 3, timeout + time.Millisecond, true},
+		{"later frame", "N0CALL", 5, 40 * time.Millisecond, true},
+		{"different source", "KC1AWV", 3, 40 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newStreamTracker(timeout)
+			start := time.Now()
+			tr.update("", 0x1234, "N0CALL", "", "M17-XXX A", 4, start)
+			tr.remove("", 0x1234)
+
+			s, _, isNew, _ := tr.update("", 0x1234, tt.src, "", "M17-XXX A", tt.fn, start.Add(tt.after))
+			if (s != nil) != tt.isNew || isNew != tt.isNew {
+				t.Errorf("update = stream %v new %t, want a new stream %t", s, isNew, tt.isNew)
+			}
+		})
+	}
+
+	tr := newStreamTracker(timeout)
+	start := time.Now()
+	tr.update("", 0x1234, "N0CALL", "", "M17-XXX A", 4, start)
+	tr.remove("", 0x1234)
+	tr.expire(start.Add(timeout + time.Millisecond))
+	if len(tr.ended) != 0 {
+		t.Errorf("remembering %d ended streams past the timeout, want none", len(tr.ended))
+	}
+}
+
+func TestStreamTrackerReuse(t *testing.T) {
+	const timeout = 2 * time.Second
+	tests := []struct {
+		name  string
+		src   string
+		dst   string
+		after time.Duration
+		split bool
+	}{
+		{"same stream", "N0CALL", "M17-XXX A", 40 * time.Millisecond, false},
+		{"at the timeout", "N0CALL", "M17-XXX A", timeout, false},
+		{"after the timeout", "N0CALL", "M17-XXX A", timeout + time.Millisecond, true},
+		{"different source", "KC1AWV", "M17-XXX A", 40 * time.Millisecond, true},
+		{"different destination", "N0CALL", "M17-XXX B", 40 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newStreamTracker(timeout)
+			start := time.Now()
+			first, _, _, _ := tr.update("", 0x1234, "N0CALL", "", "M17-XXX A", 0, start)
+
+			s, replaced, isNew, _ := tr.update("", 0x1234, tt.src, "", tt.dst, 1, start.Add(tt.after))
+			if isNew != tt.split || (replaced == first) != tt.split || (s == first) == tt.split {
+				t.Errorf("update = new %t, replaced first %t, same stream %t, want a split %t",
+					isNew, replaced == first, s == first, tt.split)
+			}
+			want := 2
+			if tt.split {
+				want = 1
+			}
+			if s.packets != want {
+				t.Errorf("stream has %d packets, want %d", s.packets, want)
+			}
+			if tr.count() != 1 {
+				t.Errorf("tracking %d streams, want 1", tr.count())
+			}
+		})
+	}
+}
+
+func TestStreamTrackerOrigins(t *testing.T) {
+	tr := newStreamTracker(DefaultStreamTimeout * time.Millisecond)
+	now := time.Now()
+
+	tests := []struct {
+		origin  string
+		fn      uint16
+		isNew   bool
+		packets int
+	}{
+		{"192.0.2.1:17000", 0, true, 1},
+		{"192.0.2.2:17000", 0, true, 1},
+		{"192.0.2.1:17000", 1, false, 2},
+		{"192.0.2.2:17000", 1, false, 2},
+		{"[2001:db8::1]:17000", 5, true, 1},
+	}
+	for i, tt := range tests {
+		s, replaced, isNew, inOrder := tr.update(tt.origin, 0x1234, "N0CALL", "", "M17-XXX A", tt.fn, now)
+		if replaced != nil || isNew != tt.isNew || !inOrder {
+			t.Errorf("update #%d from %s = replaced %v new %t in order %t, want nil, %t, true", i, tt.origin, replaced, isNew, inOrder, tt.isNew)
+		}
+		if s.origin != tt.origin || s.packets != tt.packets {
+			t.Errorf("update #%d from %s gave stream from %s with %d packets, want %d", i, tt.origin, s.origin, s.packets, tt.packets)
+		}
+	}
+	if n := tr.count(); n != 3 {
+		t.Fatalf("tracking %d streams, want 3", n)
+	}
+
+	if s := tr.remove("192.0.2.1:17000", 0x1234); s == nil || s.origin != "192.0.2.1:17000" {
+		t.Errorf("remove returned %v, want the stream from 192.0.2.1:17000", s)
+	}
+	if n := tr.count(); n != 2 {
+		t.Errorf("tracking %d streams after removing one, want 2", n)
+	}
+}
+
+func TestEmptyLSFContinuation(t *testing.T) {
+	type frame struct {
+		origin string
+		empty  bool
+		fn     uint16
+	}
+	tests := []struct {
+		name   string
+		frames []frame
+		want   int
+	}{
+		{"first frame without LSF", []frame{{"a", true, 0}}, 0},
+		{"continuation inherits LSF", []frame{{"a", false, 0}, {"a", true, 1}, {"a", true, 2}}, 3},
+		{"other origin does not inherit", []frame{{"a", false, 0}, {"b", true, 1}}, 1},
+		{"ended stream does not inherit", []frame{{"a", false, m17.LastFrameFlag}, {"a", true, 1}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, frames := newTestClient(t, Config{})
+			for _, f := range tt.frames {
+				src, dst, typ := "N0CALL", "M17-XXX A", uint16(voiceType)
+				if f.empty {
+					src, dst, typ = "", "", 0
+				}
+				c.handleStreamFrame(f.origin, makeFrame(t, 1, src, dst, typ, nil, f.fn, make([]byte, m17.PayloadSize)))
+			}
+			if len(*frames) != tt.want {
+				t.Fatalf("decoded %d frames, want %d", len(*frames), tt.want)
+			}
+			for _, f := range *frames {
+				if f.Src != "N0CALL" || f.Dst != "M17-XXX A" || f.Type != voiceType {
+					t.Errorf("frame %d attributed to %q -> %q type %#04x, want N0CALL -> M17-XXX A type %#04x",
+						f.FrameNumber, f.Src, f.Dst, f.Type, voiceType)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamErrorCounts(t *testing.T) {
+	c, frames := newTestClient(t, Config{})
+	c.codec2 = failingDecoder{c.codec2, 0xFF}
+	events := captureEvents(t, c)
+
+	payload := func(first, second byte) []byte {
+		p := make([]byte, m17.PayloadSize)
+		p[0], p[8] = first, second
+		return p
+	}
+	corrupt := makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 2, payload(0, 0))
+	corrupt[40] ^= 0x01
+
+	c.handleM17("", makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 0, payload(0, 0)))
+	c.handleM17("", makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 1, payload(0xFF, 0)))
+	c.handleM17("", corrupt)
+	c.handleM17("", makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 2, payload(0xFF, 0xFF)))
+	c.handleM17("", makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 3|m17.LastFrameFlag, payload(0, 0)))
+
+	if len(*frames) != 3 {
+		t.Errorf("played %d frames, want 3", len(*frames))
+	}
+	var end *Event
+	for _, ev := range events() {
+		if ev.Type == eventEnd {
+			end = &ev
+		}
+	}
+	if end == nil {
+		t.Fatal("no end event")
+	}
+	if end.Frames != 4 || end.CRCErrors != 1 || end.DecodeErrors != 3 {
+		t.Errorf("end event has %d frames, %d CRC errors and %d decode errors, want 4, 1 and 3", end.Frames, end.CRCErrors, end.DecodeErrors)
+	}
+}
+
+func TestStreamSummary(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		s        stream
+		timedOut bool
+		want     string
+	}{
+		{"clean", stream{id: 0x1234, src: "N0CALL", dst: "M17-XXX A", packets: 50}, false,
+			"N0CALL -> M17-XXX A, 50 frames, 2.0 s, StreamID=0x1234"},
+		{"errors", stream{id: 0x1234, src: "N0CALL", dst: "M17-XXX A", packets: 50, crcErrors: 2, decodeErrors: 5}, false,
+			"N0CALL -> M17-XXX A, 50 frames, 2.0 s, StreamID=0x1234, 2 CRC errors, 5 decode errors"},
+		{"named and timed out", stream{id: 0x1234, src: "N0CALL", name: "Test", dst: "M17-XXX A", packets: 50, decodeErrors: 1}, true,
+			"N0CALL (Test) -> M17-XXX A, 50 frames, 2.0 s, StreamID=0x1234, 0 CRC errors, 1 decode errors (timed out)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.s.started, tt.s.lastSeen = start, start.Add(2*time.Second)
+			if got := tt.s.summary(tt.timedOut); got != tt.want {
+				t.Errorf("summary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamTrackerSetPosition(t *testing.T) {
+	tr := newStreamTracker(DefaultStreamTimeout * time.Millisecond)
+	s := &stream{}
+	here, there := Position{Latitude: 42.5, Longitude: -71.25}, Position{Latitude: 42.5, Longitude: -71.5}
+
+	tests := []struct {
+		pos  Position
+		want bool
+	}{
+		{here, true},
+		{here, false},
+		{there, true},
+		{here, true},
+	}
+	for i, tt := range tests {
+		if got := tr.setPosition(s, tt.pos); got != tt.want {
+			t.Errorf("setPosition #%d = %t, want %t", i, got, tt.want)
+		}
+		if s.position == nil || !s.position.equal(tt.pos) {
+			t.Errorf("setPosition #%d recorded %v, want %v", i, s.position, tt.pos)
+		}
+	}
+}
+
+func TestStreamConcurrentSnapshot(t *testing.T) {
+	c, _ := newTestClient(t, Config{HighPass: true, RecordDir: t.TempDir()})
+
+	// Snapshot from another goroutine, as the TUI does, while frames
+	// carrying text, positions and reserved TYPE bits update one stream and
+	// a run of new streams set up their filters and recordings
+	var wg sync.WaitGroup
+	started, done := make(chan struct{}), make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		close(started)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				c.streams.snapshot()
+			}
+		}
+	}()
+
+	text := make([]byte, 14)
+	text[0] = 0x11
+	copy(text[1:], "HI")
+	<-started
+	for fn := uint16(0); fn < 1000; fn++ {
+		meta, typ := text, uint16(voiceType|0x0800)
+		if fn%2 == 1 {
+			meta = []byte{0, 0, 42, 0x7F, 0xFF, 71, 0x40, byte(fn), 0x02, 0, 0, 0, 0, 0}
+			typ |= 0b01 << 5
+		}
+		c.handleStreamFrame("", makeFrame(t, 1, "N0CALL", "M17-XXX A", typ, meta, fn, make([]byte, m17.PayloadSize)))
+		c.handleStreamFrame("", makeFrame(t, 2+fn%100, "KC1AWV", "M17-XXX A", voiceType, nil, fn/100, make([]byte, m17.PayloadSize)))
+	}
+	close(done)
+	wg.Wait()
+
+	s := c.streams.streams[streamKey{"", 1}]
+	if s == nil {
+		t.Fatal("stream not tracked")
+	}
+	if s.text == nil || s.text.message() != "HI" || s.position == nil || s.reserved != 0x0800 {
+		t.Errorf("stream text %v position %v reserved %#04x, want HI, a position and 0x0800", s.text, s.position, s.reserved)
+	}
+}
+
+func TestStreamTrackerExpire(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	tests := []struct {
+		name    string
+		idle    []time.Duration // time since each stream was last seen
+		expired []uint16
+	}{
+		{"none idle", []time.Duration{0, 10 * time.Millisecond}, nil},
+		{"at the timeout", []time.Duration{timeout}, nil},
+		{"past the timeout", []time.Duration{timeout + time.Millisecond}, []uint16{0}},
+		{"some idle", []time.Duration{0, time.Second, 20 * time.Millisecond, 2 * timeout}, []uint16{1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newStreamTracker(timeout)
+			now := time.Now()
+			for id, idle := range tt.idle {
+				tr.update("", uint16(id), "N0CALL", "", "M17-XXX A", 0, now.Add(-idle))
+			}
+
+			var got []uint16
+			for _, s := range tr.expire(now) {
+				got = append(got, s.id)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.expired) {
+				t.Errorf("expired streams %v, want %v", got, tt.expired)
+			}
+			if want := len(tt.idle) - len(tt.expired); tr.count() != want {
+				t.Errorf("tracking %d streams after expiry, want %d", tr.count(), want)
+			}
+		})
+	}
+}
+
+func TestReapStreams(t *testing.T) {
+	c, _ := newTestClient(t, Config{StreamTimeout: 20})
+	events := captureEvents(t, c)
+	c.handleStreamFrame("", makeFrame(t, 1, "N0CALL", "M17-XXX A", voiceType, nil, 0, make([]byte, m17.PayloadSize)))
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.reapStreams()
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for c.streams.count() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stream not reaped after its timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Wait for the reaper to finish reporting the stream
+	c.Close()
+
+	var ends []Event
+	for _, ev := range events() {
+		if ev.Type == eventEnd {
+			ends = append(ends, ev)
+		}
+	}
+	if len(ends) != 1 || !ends[0].TimedOut || ends[0].StreamID != 1 {
+		t.Errorf("end events %+v, want one timed out end of stream 1", ends)
+	}
+}
+
+func TestInvalidStreamTimeout(t *testing.T) {
+	for _, timeout := range []int{0, -1, -2000} {
+		if c, err := newClient(Config{NoSound: true, StreamTimeout: timeout}); err == nil {
+			c.Close()
+			t.Errorf("newClient with a %d ms stream timeout succeeded, want an error", timeout)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package transcode
+
+/*
+#cgo LDFLAGS: -lopus
+#include <opus/opus.h>
+#include <stdlib.h>
+
+// opus_encoder_ctl is variadic, so wrap the requests we need for cgo
+static int set_bitrate(OpusEncoder *enc, opus_int32 bitrate) {
+	return opus_encoder_ctl(enc, OPUS_SET_BITRATE(bitrate));
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// maxPacketSize is the largest Opus packet we allow the encoder to produce
+const maxPacketSize = 4000
+
+// frameDuration is the length of each Opus frame in milliseconds
+const frameDuration = 20
+
+// Opus represents an Opus encoder
+type Opus struct {
+	handle     *C.OpusEncoder
+	sampleRate int
+	channels   int
+}
+
+// sampleRates lists the sample rates Opus supports
+var sampleRates = map[int]bool{
+	8000:  true,
+	12000: true,
+	16000: true,
+	24000: true,
+	48000: true,
+}
+
+// NewOpus creates a new Opus encoder tuned for voice. A bitrate of 0 lets
+// the encoder choose.
+func NewOpus(sampleRate, channels, bitrate int) (*Opus, error) {
+	if !sampleRates[sampleRate] {
+		return nil, fmt.Errorf("unsupported opus sample rate: %d", sampleRate)
+	}
+	if channels != 1 && channels != 2 {
+		return nil, fmt.Errorf("unsupported opus channel count: %d", channels)
+	}
+
+	var cerr C.int
+	handle := C.opus_encoder_create(C.opus_int32(sampleRate), C.int(channels), C.OPUS_APPLICATION_VOIP, &cerr)
+	if cerr != C.OPUS_OK || handle == nil {
+		return nil, fmt.Errorf("failed to create opus encoder: %s", C.GoString(C.opus_strerror(cerr)))
+	}
+
+	o := &Opus{handle: handle, sampleRate: sampleRate, channels: channels}
+	if bitrate > 0 {
+		if cerr := C.set_bitrate(handle, C.opus_int32(bitrate)); cerr != C.OPUS_OK {
+			o.Close()
+			return nil, fmt.Errorf("failed to set opus bitrate %d: %s", bitrate, C.GoString(C.opus_strerror(cerr)))
+		}
+	}
+	return o, nil
+}
+
+// Close closes the Opus encoder
+func (o *Opus) Close() {
+	if o.handle == nil {
+		return
+	}
+	C.opus_encoder_destroy(o.handle)
+	o.handle = nil
+}
+
+// SampleRate returns the encoder sample rate in Hz
+func (o *Opus) SampleRate() int {
+	return o.sampleRate
+}
+
+// SamplesPerFrame returns the number of samples per channel in a frame
+func (o *Opus) SamplesPerFrame() int {
+	return o.sampleRate * frameDuration / 1000
+}
+
+// Encode encodes one frame of interleaved audio samples to an Opus packet
+func (o *Opus) Encode(samples []int16) ([]byte, error) {
+	if len(samples) != o.SamplesPerFrame()*o.channels {
+		return nil, errors.New("invalid sample count")
+	}
+
+	packet := make([]byte, maxPacketSize)
+	n := C.opus_encode(o.handle, (*C.opus_int16)(unsafe.Pointer(&samples[0])), C.int(o.SamplesPerFrame()),
+		(*C.uchar)(unsafe.Pointer(&packet[0])), C.opus_int32(len(packet)))
+	if n < 0 {
+		return nil, fmt.Errorf("failed to encode opus frame: %s", C.GoString(C.opus_strerror(C.int(n))))
+	}
+
+	return packet[:n], nil
+}
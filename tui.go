@@ -0,0 +1,144 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// tuiRefresh is how often the TUI redraws to keep durations current
+const tuiRefresh = 500 * time.Millisecond
+
+// tui is a full-screen terminal view of live and recent activity
+type tui struct {
+	screen  tcell.Screen
+	client  *Client
+	changed chan struct{}
+}
+
+// newTUI takes over the terminal
+func newTUI(c *Client) (*tui, error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create terminal screen: %w", err)
+	}
+	if err := screen.Init(); err != nil {
+		return nil, fmt.Errorf("failed to initialize terminal screen: %w", err)
+	}
+	screen.HideCursor()
+
+	return &tui{
+		screen:  screen,
+		client:  c,
+		changed: make(chan struct{}, 1),
+	}, nil
+}
+
+// refresh asks for a redraw without blocking
+func (t *tui) refresh() {
+	select {
+	case t.changed <- struct{}{}:
+	default:
+	}
+}
+
+// run redraws the view until the context is cancelled. Quitting from the
+// keyboard cancels the client.
+func (t *tui) run(ctx context.Context) {
+	go func() {
+		for {
+			switch ev := t.screen.PollEvent().(type) {
+			case nil:
+				// The screen has been finalized
+				return
+			case *tcell.EventKey:
+				if ev.Key() == tcell.KeyCtrlC || ev.Key() == tcell.KeyEscape || ev.Rune() == 'q' {
+					t.client.cancel()
+				}
+			case *tcell.EventResize:
+				t.screen.Sync()
+				t.refresh()
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+
+	for {
+		t.draw(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-t.changed:
+		}
+	}
+}
+
+// close restores the terminal
+func (t *tui) close() {
+	t.screen.Fini()
+}
+
+// draw renders the active streams and the last heard list
+func (t *tui) draw(now time.Time) {
+	bold := tcell.StyleDefault.Bold(true)
+	live := tcell.StyleDefault.Foreground(tcell.ColorGreen).Bold(true)
+
+	t.screen.Clear()
+	_, height := t.screen.Size()
+	row := 0
+	t.print(row, bold, "M17 Gateway Monitor   (q to quit)")
+	row += 2
+
+	t.print(row, bold, "Transmitting")
+	row++
+	active := t.client.streams.snapshot()
+	if len(active) == 0 {
+		t.print(row, tcell.StyleDefault, "  (none)")
+		row++
+	}
+	for _, s := range active {
+		t.print(row, live, fmt.Sprintf("  %-9s -> %-9s %6.1f s  StreamID 0x%04X  %s", s.src, s.dst, now.Sub(s.started).Seconds(), s.id, s.name))
+		row++
+	}
+	row++
+
+	t.print(row, bold, "Last heard")
+	row++
+	t.print(row, bold, fmt.Sprintf("  %-8s  %-9s  %-9s  %8s  %s", "Time", "Source", "Dest", "Duration", "Name"))
+	row++
+	for _, e := range t.client.heard.recent(height - row) {
+		t.print(row, tcell.StyleDefault, fmt.Sprintf("  %-8s  %-9s  %-9s  %6.1f s  %s", e.Timestamp.Format("15:04:05"), e.Src, e.Dst, e.Duration, e.Name))
+		row++
+	}
+
+	t.screen.Show()
+}
+
+// print writes a line of text at the given row
+func (t *tui) print(row int, style tcell.Style, text string) {
+	for col, r := range []rune(text) {
+		t.screen.SetContent(col, row, r, nil, style)
+	}
+}
@@ -17,25 +17,15 @@ this program. If not, see <http://www.gnu.org/licenses/>.
 
 package main
 
-// base40Chars is the character set used for encoding callsigns
-const (
-	base40Chars = " ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-/."
-)
-
-// decodeCallsign decodes a 6-byte address into a callsign
-func decodeCallsign(encoded []byte) string {
-	address := uint64(0)
-
-	for _, b := range encoded {
-		address = address*256 + uint64(b)
+import "strings"
+
+// splitDestination splits a destination such as "M17-XXX D" into its base
+// callsign and module letter. Destinations without a trailing space and
+// single letter, including the broadcast label, have no module.
+func splitDestination(dst string) (base, module string) {
+	n := len(dst)
+	if n < 3 || dst[n-2] != ' ' || dst[n-1] < 'A' || dst[n-1] > 'Z' {
+		return dst, ""
 	}
-
-	callsign := ""
-	for address > 0 {
-		idx := address % 40
-		callsign += string(base40Chars[idx])
-		address /= 40
-	}
-
-	return callsign
+	return strings.TrimRight(dst[:n-2], " "), dst[n-1:]
 }
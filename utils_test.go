@@ -0,0 +1,44 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import "testing"
+
+func TestSplitDestination(t *testing.T) {
+	tests := []struct {
+		dst, base, module string
+	}{
+		{"KC1AWV", "KC1AWV", ""},
+		{"M17-XXX A", "M17-XXX", "A"},
+		{"M17-XXX D", "M17-XXX", "D"},
+		{"M17-XX  Z", "M17-XX", "Z"},
+		{"@ALL", "@ALL", ""},
+		{"M17-XXX 1", "M17-XXX 1", ""},
+		{"N0CALL/P", "N0CALL/P", ""},
+		{" A", " A", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dst, func(t *testing.T) {
+			base, module := splitDestination(tt.dst)
+			if base != tt.base || module != tt.module {
+				t.Errorf("splitDestination(%q) = %q, %q, want %q, %q", tt.dst, base, module, tt.base, tt.module)
+			}
+		})
+	}
+}
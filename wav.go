@@ -0,0 +1,140 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wavHeaderSize is the size of a canonical 16-bit PCM WAV header
+const wavHeaderSize = 44
+
+// wavWriter writes 16-bit mono PCM samples to a WAV file
+type wavWriter struct {
+	mu         sync.Mutex
+	f          *os.File
+	sampleRate int
+	dataBytes  uint32
+}
+
+// newWAVWriter creates a WAV file and writes a placeholder header
+func newWAVWriter(path string, sampleRate int) (*wavWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	w := &wavWriter{f: f, sampleRate: sampleRate}
+	if _, err := f.Write(w.header()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write WAV header: %w", err)
+	}
+
+	return w, nil
+}
+
+// header builds the WAV header for the samples written so far
+func (w *wavWriter) header() []byte {
+	return wavHeader(w.sampleRate, w.dataBytes)
+}
+
+// wavHeader builds a 16-bit mono PCM WAV header for dataBytes of samples
+func wavHeader(sampleRate int, dataBytes uint32) []byte {
+	h := make([]byte, wavHeaderSize)
+	copy(h[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:8], 36+dataBytes)
+	copy(h[8:12], "WAVE")
+	copy(h[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:20], 16)                   // fmt chunk size
+	binary.LittleEndian.PutUint16(h[20:22], 1)                    // PCM
+	binary.LittleEndian.PutUint16(h[22:24], 1)                    // mono
+	binary.LittleEndian.PutUint32(h[24:28], uint32(sampleRate))   // sample rate
+	binary.LittleEndian.PutUint32(h[28:32], uint32(sampleRate*2)) // byte rate
+	binary.LittleEndian.PutUint16(h[32:34], 2)                    // block align
+	binary.LittleEndian.PutUint16(h[34:36], 16)                   // bits per sample
+	copy(h[36:40], "data")
+	binary.LittleEndian.PutUint32(h[40:44], dataBytes)
+	return h
+}
+
+// write appends samples to the file
+func (w *wavWriter) write(samples []int16) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return errors.New("WAV file is closed")
+	}
+
+	buf := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(sample))
+	}
+
+	n, err := w.f.Write(buf)
+	w.dataBytes += uint32(n)
+	return err
+}
+
+// Close rewrites the header with the final sizes and closes the file
+func (w *wavWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	defer func() { w.f = nil }()
+
+	if _, err := w.f.WriteAt(w.header(), 0); err != nil {
+		w.f.Close()
+		return fmt.Errorf("failed to finalize WAV header: %w", err)
+	}
+	return w.f.Close()
+}
+
+// recordingPath builds the file name for a stream recording. The origin, if
+// known, is included so streams from different reflectors stay apart.
+func recordingPath(dir string, started time.Time, src, dst, origin string) string {
+	name := fmt.Sprintf("%s_%s_%s", started.Format("20060102-150405"), fileSafe(src), fileSafe(dst))
+	if origin != "" {
+		name += "_" + strings.NewReplacer(":", "-", "[", "", "]", "").Replace(origin)
+	}
+	return filepath.Join(dir, name+".wav")
+}
+
+// fileSafe makes a callsign usable as part of a file name
+func fileSafe(callsign string) string {
+	callsign = strings.TrimSpace(callsign)
+	if callsign == "" {
+		return "UNKNOWN"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, callsign)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (C) 2024 Steve Miller KC1AWV
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the Free
+Software Foundation, either version 3 of the License, or (at your option)
+any later version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT
+ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License for
+more details.
+
+You should have received a copy of the GNU General Public License along with
+this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+//go:embed web/index.html
+var indexHTML []byte
+
+// webClientBuffer is how many events may queue for a slow browser before
+// further events are dropped for it
+const webClientBuffer = 32
+
+// webHub fans events out to connected WebSocket clients
+type webHub struct {
+	mu       sync.Mutex
+	clients  map[chan []byte]struct{}
+	upgrader websocket.Upgrader
+}
+
+// newWebHub creates an empty hub
+func newWebHub() *webHub {
+	return &webHub{clients: make(map[chan []byte]struct{})}
+}
+
+// broadcast sends an event to every connected client without blocking
+func (h *webHub) broadcast(ev Event) {
+	msg, err := json.Marshal(ev)
+	if err != nil {
+		slog.Error("failed to encode web event", "err", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for send := range h.clients {
+		select {
+		case send <- msg:
+		default:
+			slog.Debug("dropping event for slow web client")
+		}
+	}
+}
+
+// serveWS upgrades a request to a WebSocket and streams events to it
+func (h *webHub) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Debug("failed to upgrade web client", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	send := make(chan []byte, webClientBuffer)
+	h.mu.Lock()
+	h.clients[send] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, send)
+		h.mu.Unlock()
+	}()
+
+	// Read and discard client messages so we notice when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case msg := <-send:
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveWeb starts an HTTP server with the live page and WebSocket endpoint
+func (c *Client) serveWeb(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(indexHTML)
+	})
+	mux.HandleFunc("/ws", c.web.serveWS)
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("web server failed", "err", err)
+		}
+	}()
+
+	return srv, nil
+}